@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/citations"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/config"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/corners"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/window"
+)
+
+// chatTurn is a user message posted to a chat, with the chat and its
+// history.
+type chatTurn struct {
+	chat    *db.Chat
+	msg     db.ChatMessage
+	history []db.ChatMessage
+	// query is the standalone question used for retrieval, see condenseQuery.
+	query string
+}
+
+// prompt is what gets sent to the LLM for one user message.
+type prompt struct {
+	route    string
+	messages []llm.Message
+	// realMessage is stored next to the user message and replayed instead of
+	// it in follow-up turns.
+	realMessage string
+	documents   []templater.Document
+}
+
+func (s *server) existingChatPrompt(ctx context.Context, turn *chatTurn, embedding []float64) (*prompt, error) {
+	msg := turn.msg
+
+	// Messages covered by the summary are replayed through it.
+	summary := s.chatSummary(turn.chat.ID)
+	summaryText := ""
+	if summary != nil {
+		summaryText = summary.Summary
+	}
+	recent := unsummarized(turn.history, summary)
+
+	history := make([]llm.Message, 0, len(recent))
+	for _, m := range recent {
+		role := llm.RoleAssistant
+		if !m.IsBot {
+			role = llm.RoleUser
+		}
+
+		message := m.Message
+		if m.RealMessage != "" {
+			message = m.RealMessage
+		}
+		history = append(history, llm.Message{
+			Role:    role,
+			Content: message,
+		})
+	}
+
+	documents, err := s.getRelatedDocuments(ctx, turn.query, embedding, turn.chat.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.fitPrompt(config.RouteAllQuestions, history, documents, func(documents []templater.Document) (string, error) {
+		if len(documents) == 0 {
+			return s.tmpl.ProcessTemplateNoAnswer(msg.Message, msg.Language)
+		}
+		return s.tmpl.ProcessTemplateAllQuestionsData(msg.Message, msg.Language, summaryText, documents)
+	})
+}
+
+func (s *server) newChatPrompt(ctx context.Context, turn *chatTurn, embedding []float64) (*prompt, error) {
+	msg := turn.msg
+	documents, err := s.getRelatedDocuments(ctx, turn.query, embedding, turn.chat.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.fitPrompt(config.RouteInitQuestion, nil, documents, func(documents []templater.Document) (string, error) {
+		if len(documents) == 0 {
+			return s.tmpl.ProcessTemplateNoAnswer(msg.Message, msg.Language)
+		}
+		return s.tmpl.ProcessTemplateInitQuestionData([]templater.InitQuestionData{
+			{
+				Language:  msg.Language,
+				Question:  msg.Message,
+				Documents: documents,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.realMessage = p.messages[len(p.messages)-1].Content
+
+	return p, nil
+}
+
+// fitPrompt renders the user message with render and fits it together with
+// the history into the token budget of the route model. The oldest history
+// turns are dropped first; when the user message alone is too long, the
+// least relevant documents are left out as a last resort.
+func (s *server) fitPrompt(route string, history []llm.Message, documents []templater.Document,
+	render func(documents []templater.Document) (string, error)) (*prompt, error) {
+	model := s.cfg.Route(route).Model
+	budget := s.cfg.Context.Budget(model)
+
+	for {
+		content, err := render(documents)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := window.Fit(s.tokenizer, budget, window.Input{
+			History: history,
+			Prompt:  llm.Message{Role: llm.RoleUser, Content: content},
+		})
+		var budgetErr *window.BudgetError
+		if errors.As(err, &budgetErr) && len(documents) > 1 {
+			log.Printf("prompt for %s: %v, dropping document %s", model, err, documents[len(documents)-1].ID)
+			documents = documents[:len(documents)-1]
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prompt for %s: %w", model, err)
+		}
+		if res.Dropped > 0 {
+			log.Printf("prompt for %s: dropped %d oldest messages to fit %d tokens", model, res.Dropped, budget)
+		}
+
+		return &prompt{
+			route:     route,
+			messages:  res.Messages,
+			documents: documents,
+		}, nil
+	}
+}
+
+// buildPrompt retrieves the documents for the turn and renders the prompt.
+// Without relevant documents the prompt asks the model to say it does not
+// know instead of answering from unrelated chunks.
+func (s *server) buildPrompt(ctx context.Context, turn *chatTurn, embedding []float64) (*prompt, error) {
+	if len(turn.history) == 0 {
+		return s.newChatPrompt(ctx, turn, embedding)
+	}
+	return s.existingChatPrompt(ctx, turn, embedding)
+}
+
+// saveExchange stores the user message and the answer to it. It returns the
+// stored bot message.
+func saveExchange(turn *chatTurn, p *prompt, resp *llm.Response) (*db.ChatMessage, error) {
+	msg := turn.msg
+	documentIDs := make([]string, 0, len(p.documents))
+	for _, d := range p.documents {
+		documentIDs = append(documentIDs, d.ID)
+	}
+
+	userMsg := db.ChatMessage{
+		ChatID:      msg.ChatID,
+		Message:     msg.Message,
+		RealMessage: p.realMessage,
+		Language:    msg.Language,
+		DocumentIDs: documentIDs,
+	}
+	if turn.query != msg.Message {
+		userMsg.RewrittenQuery = turn.query
+	}
+	err := db.InsertChatMessage(&userMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	botMsg := db.ChatMessage{
+		ChatID:      msg.ChatID,
+		Message:     resp.Content,
+		IsBot:       true,
+		Language:    msg.Language,
+		Model:       resp.Model,
+		Usage:       resp.Usage,
+		DocumentIDs: documentIDs,
+		Citations:   citations.Resolve(resp.Content, citations.FromDocuments(p.documents)),
+	}
+	err = db.InsertChatMessage(&botMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &botMsg, nil
+}
+
+// detectCorners returns the corner cases matching the question. Failing
+// classifiers are logged and treated as not matching.
+func (s *server) detectCorners(ctx context.Context, question string, embedding []float64) []corners.Match {
+	if s.corners == nil {
+		return nil
+	}
+
+	matches, err := s.corners.Classify(ctx, corners.Query{Text: question, Embedding: embedding})
+	if err != nil {
+		log.Printf("corner detection: %v", err)
+	}
+	return matches
+}
+
+// cornerAnswer is the canned reply stored in place of an LLM answer when
+// the message matches corner cases.
+func cornerAnswer(matches []corners.Match) *llm.Response {
+	return &llm.Response{Content: corners.Answer(matches)}
+}
+
+// bindChatMessage reads the message posted to /chat/:chatID together with
+// the chat and its history. It writes the error response itself and returns
+// nil on failure.
+func bindChatMessage(c *gin.Context) *chatTurn {
+	var msg db.ChatMessage
+	if err := c.ShouldBindJSON(&msg); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil
+	}
+
+	chat := getChat(c)
+	if chat == nil {
+		return nil
+	}
+	msg.ChatID = chat.ID
+
+	chatMessages, err := db.GetChatMessages(msg.ChatID)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err})
+		return nil
+	}
+
+	// Follow-up turns keep the language picked earlier in the chat.
+	if msg.Language == "" {
+		for i := len(chatMessages) - 1; i >= 0; i-- {
+			if chatMessages[i].Language != "" {
+				msg.Language = chatMessages[i].Language
+				break
+			}
+		}
+	}
+
+	return &chatTurn{chat: chat, msg: msg, history: chatMessages, query: msg.Message}
+}
+
+func (s *server) postToChat(c *gin.Context) {
+	turn := bindChatMessage(c)
+	if turn == nil {
+		return
+	}
+	turn.query = s.condenseQuery(c.Request.Context(), turn)
+
+	embedding, err := s.embedQuery(c.Request.Context(), turn.query)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	matches := s.detectCorners(c.Request.Context(), turn.query, embedding)
+	if len(matches) > 0 {
+		botMsg, err := saveExchange(turn, &prompt{}, cornerAnswer(matches))
+		if err != nil {
+			c.JSON(500, gin.H{"status": err.Error()})
+			return
+		}
+		s.updateSummaryAsync(turn.chat.ID)
+
+		c.JSON(200, gin.H{"status": "message added", "response": botMsg.Message, "message": botMsg,
+			"citations": botMsg.Citations, "corners": corners.Names(matches)})
+		return
+	}
+
+	p, err := s.buildPrompt(c.Request.Context(), turn, embedding)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	resp, err := s.completer(p.route).Complete(c.Request.Context(), llm.Request{
+		Messages: p.messages,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	botMsg, err := saveExchange(turn, p, resp)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+	s.updateSummaryAsync(turn.chat.ID)
+
+	c.JSON(200, gin.H{"status": "message added", "response": resp.Content, "message": botMsg,
+		"citations": botMsg.Citations, "corners": []string{}})
+}
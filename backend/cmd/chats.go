@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/retrieval"
+)
+
+func getChats(c *gin.Context) {
+	chats, err := db.ListChats(c.Query("owner"))
+	if err != nil {
+		c.JSON(500, gin.H{"status": err})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"status": "success", "chats": chats})
+	}
+}
+
+type createChatRequest struct {
+	Title   string           `json:"title"`
+	Owner   string           `json:"owner"`
+	Filters retrieval.Filter `json:"filters"`
+}
+
+// createChat allocates a new chat. The owner defaults to the basic auth user.
+func createChat(c *gin.Context) {
+	var req createChatRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Owner == "" {
+		req.Owner, _, _ = c.Request.BasicAuth()
+	}
+	if err := req.Filters.Validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	chat, err := db.CreateChat(req.Title, req.Owner, req.Filters)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "chat": chat})
+}
+
+// getChat loads the chat of the :chatID parameter. It writes the error
+// response itself and returns nil on failure.
+func getChat(c *gin.Context) *db.Chat {
+	chat, err := db.GetChat(c.Param("chatID"))
+	if errors.Is(err, db.ErrChatNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"status": err.Error()})
+		return nil
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return nil
+	}
+	return chat
+}
+
+type updateChatRequest struct {
+	Title   *string           `json:"title"`
+	Filters *retrieval.Filter `json:"filters"`
+}
+
+// updateChat renames a chat or changes the filters narrowing its documents,
+// e.g. to one product line.
+func updateChat(c *gin.Context) {
+	var req updateChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Filters != nil {
+		if err := req.Filters.Validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	chat := getChat(c)
+	if chat == nil {
+		return
+	}
+
+	chat, err := db.UpdateChat(chat.ID, req.Title, req.Filters)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "chat": chat})
+}
+
+func getChatById(c *gin.Context) {
+	chat := getChat(c)
+	if chat == nil {
+		return
+	}
+
+	messages, err := db.GetChatMessages(chat.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err})
+		return
+	}
+
+	c.JSON(200, messages)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/config"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+// condenseQuery returns the question used for retrieval and corner
+// detection. Follow-ups are rewritten into a standalone question using the
+// chat history; the message itself is returned for the first turn, when
+// rewriting is disabled or when it fails.
+func (s *server) condenseQuery(ctx context.Context, turn *chatTurn) string {
+	question := turn.msg.Message
+	if !s.cfg.Condense.Enabled || len(turn.history) == 0 {
+		return question
+	}
+
+	if s.cfg.Condense.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Condense.Timeout)
+		defer cancel()
+	}
+
+	history := turn.history
+	if n := s.cfg.Condense.History; n > 0 && len(history) > n {
+		history = history[len(history)-n:]
+	}
+	prompt, err := s.tmpl.ProcessTemplateCondense(historyMessages(history), question)
+	if err != nil {
+		log.Printf("condense query: %v", err)
+		return question
+	}
+
+	temperature := 0.0
+	resp, err := s.completer(config.RouteCondense).Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		log.Printf("condense query: %v", err)
+		return question
+	}
+
+	rewritten := strings.Trim(strings.TrimSpace(resp.Content), "\"")
+	if rewritten == "" {
+		return question
+	}
+	return rewritten
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+)
+
+func getDocuments(c *gin.Context) {
+	documents, err := db.ListDocuments()
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "documents": documents})
+}
+
+// getDocument streams the source PDF of the :id parameter. Range requests
+// are supported so that viewers can load large datasheets page by page.
+func getDocument(c *gin.Context) {
+	document, err := db.GetDocument(c.Param("id"))
+	if errors.Is(err, db.ErrDocumentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"status": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	f, err := os.Open(document.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "document file is gone"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	name := filepath.Base(document.Path)
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	http.ServeContent(c.Writer, c.Request, name, document.ModifiedAt, f)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+)
+
+const migrateUsage = `Usage: backend migrate [flags] [up|status]
+
+  up      apply pending migrations (default)
+  status  list migrations and whether they are applied
+
+Flags:
+`
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := fs.String("db", "chat.db", "path to the SQLite database")
+	to := fs.Int("to", 0, "apply migrations up to this version only (0 means latest)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	command := "up"
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("too many arguments")
+	}
+	if fs.NArg() == 1 {
+		command = fs.Arg(0)
+	}
+
+	err := db.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.CloseDB()
+
+	switch command {
+	case "up":
+		before, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if err := db.MigrateTo(*to); err != nil {
+			return err
+		}
+		after, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if before == after {
+			fmt.Printf("schema is up to date at version %d\n", after)
+		} else {
+			fmt.Printf("migrated schema from version %d to %d\n", before, after)
+		}
+		return nil
+	case "status":
+		return printMigrationStatus()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+func printMigrationStatus() error {
+	statuses, err := db.GetMigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return w.Flush()
+}
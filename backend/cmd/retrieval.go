@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/documents"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/rerank"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/retrieval"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+	"github.com/siriusfreak/hack-zurich-2023/lib/vectorstore"
+)
+
+// embedQuery returns the embedding of a user message, shared by corner
+// detection and retrieval.
+func (s *server) embedQuery(ctx context.Context, message string) ([]float64, error) {
+	if s.cfg.Embedding.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Embedding.Timeout)
+		defer cancel()
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{message})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// getRelatedDocuments retrieves the context documents for a question. With
+// reranking enabled a wider candidate set is retrieved and reranked; the
+// result is empty when no candidate passes the score cutoff. When reranking
+// fails, the best retrieved candidates are used.
+func (s *server) getRelatedDocuments(ctx context.Context, text string, embedding []float64, filter retrieval.Filter) ([]templater.Document, error) {
+	settings := s.cfg.Retrieval
+	size := settings.Size
+	k := settings.K
+	numCandidates := settings.NumCandidates
+	if s.reranker != nil {
+		size = settings.Rerank.Candidates
+		if k < size {
+			k = size
+		}
+		if numCandidates < k {
+			numCandidates = k
+		}
+	}
+
+	hits, err := s.store.Search(ctx, vectorstore.Query{
+		Text:          text,
+		Vector:        embedding,
+		Mode:          settings.Mode,
+		K:             k,
+		NumCandidates: numCandidates,
+		Size:          size,
+		TextWeight:    settings.TextWeight,
+		VectorWeight:  settings.VectorWeight,
+		RankConstant:  settings.RankConstant,
+		Filter:        filter.StoreFilter(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]templater.Document, 0, len(hits))
+	for _, hit := range hits {
+		documents = append(documents, templater.Document{
+			ID:      hit.ID,
+			Url:     s.documentURL(hit.Document),
+			Offset:  hit.Offset,
+			Page:    hit.Page,
+			Content: hit.Content,
+			Score:   hit.Score,
+		})
+	}
+
+	if s.reranker == nil {
+		return documents, nil
+	}
+
+	if settings.Rerank.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Rerank.Timeout)
+		defer cancel()
+	}
+
+	selected, err := rerank.Select(ctx, s.reranker, text, documents, settings.Size, settings.Rerank.MinScore)
+	if err != nil {
+		log.Printf("rerank: %v, keeping the retrieval order", err)
+		if len(documents) > settings.Size {
+			documents = documents[:settings.Size]
+		}
+		return documents, nil
+	}
+	return selected, nil
+}
+
+// documentURL links a chunk to its page in the PDF served by the backend.
+// Chunks indexed without a document ID are looked up in the registry by
+// source file; the indexed link is the last resort.
+func (s *server) documentURL(source vectorstore.Document) string {
+	id := source.DocumentID
+	if id == "" && source.SourceFile != "" {
+		if d, err := db.GetDocumentBySourceFile(source.SourceFile); err == nil {
+			id = d.ID
+		}
+	}
+	if id != "" {
+		return documents.URL(s.cfg.Documents.BaseURL, id, source.Page)
+	}
+
+	if len(source.Links) > 0 {
+		return source.Links[0]
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/config"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/corners"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/rerank"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+	"github.com/siriusfreak/hack-zurich-2023/lib/embedding"
+	"github.com/siriusfreak/hack-zurich-2023/lib/vectorstore"
+)
+
+type server struct {
+	tmpl    *templater.Templater
+	cfg     *config.Config
+	llms    map[string]llm.ChatCompleter
+	corners corners.Classifier
+	// reranker is nil when reranking is disabled.
+	reranker  rerank.Reranker
+	tokenizer llm.Tokenizer
+	embedder  embedding.Embedder
+	store     vectorstore.VectorStore
+	// summarizing holds the IDs of the chats whose summary is being updated.
+	summarizing sync.Map
+}
+
+func newServer(tmpl *templater.Templater, cfg *config.Config) (*server, error) {
+	s := &server{
+		tmpl: tmpl,
+		cfg:  cfg,
+		llms: make(map[string]llm.ChatCompleter),
+
+		tokenizer: llm.ApproxTokenizer{},
+	}
+
+	embedder, err := embedding.New(embedding.Config{
+		Provider:     cfg.Embedding.Provider,
+		Dimension:    cfg.Embedding.Dimension,
+		ProjectID:    cfg.Embedding.ProjectID,
+		Region:       cfg.Embedding.Region,
+		Model:        cfg.Embedding.Model,
+		Endpoint:     cfg.Embedding.Endpoint,
+		MaxInstances: cfg.Embedding.MaxInstances,
+		Retries:      cfg.Embedding.Retries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.embedder = embedder
+
+	s.store, err = vectorstore.Open(vectorstore.Config{
+		Kind:           cfg.Retrieval.Store,
+		IndexURL:       strings.TrimSuffix(cfg.Retrieval.URL, "/") + "/" + cfg.Retrieval.Index,
+		Authorization:  "Basic " + os.Getenv("ELASTIC_SEARCH_TOKEN"),
+		Path:           cfg.Retrieval.Path,
+		EmbeddingModel: embedder.Model(),
+		Dimension:      embedder.Dimension(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	routes := []string{config.RouteDefault, config.RouteInitQuestion, config.RouteAllQuestions,
+		config.RouteCorner, config.RouteRerank, config.RouteCondense, config.RouteSummary}
+	for _, route := range routes {
+		m := cfg.Route(route)
+		completer, err := llm.New(m.Provider, m.Model)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		s.llms[route] = completer
+	}
+
+	if cfg.Corners.Enabled {
+		completer := s.completer(config.RouteCorner)
+		switch cfg.Corners.Strategy {
+		case config.CornersParallel:
+			s.corners = corners.NewParallel(tmpl, completer, cfg.Corners.Timeout)
+		case config.CornersMultiLabel, "":
+			s.corners = corners.NewMultiLabel(tmpl, completer, cfg.Corners.Timeout, cfg.Corners.Threshold)
+		case config.CornersEmbedding:
+			classifier, err := corners.NewEmbedding(tmpl, s.embedder,
+				cfg.Corners.EmbeddingCache, cfg.Corners.Similarity)
+			if err != nil {
+				return nil, err
+			}
+			s.corners = classifier
+		default:
+			return nil, fmt.Errorf("unknown corners strategy %q", cfg.Corners.Strategy)
+		}
+	}
+
+	switch cfg.Retrieval.Rerank.Strategy {
+	case config.RerankNone, "":
+	case config.RerankLLM:
+		s.reranker = rerank.NewLLM(tmpl, s.completer(config.RouteRerank), s.tokenizer,
+			cfg.Context.Budget(cfg.Route(config.RouteRerank).Model))
+	case config.RerankLexical:
+		s.reranker = rerank.NewLexical()
+	default:
+		return nil, fmt.Errorf("unknown rerank strategy %q", cfg.Retrieval.Rerank.Strategy)
+	}
+
+	return s, nil
+}
+
+// completer returns the LLM configured for the route.
+func (s *server) completer(route string) llm.ChatCompleter {
+	if completer, ok := s.llms[route]; ok {
+		return completer
+	}
+	return s.llms[config.RouteDefault]
+}
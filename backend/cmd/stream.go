@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/corners"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+// postToChatStream is the streaming variant of postToChat. The answer is sent
+// as Server-Sent Events:
+//
+//	event: delta  data: {"content": "..."}   one per generated chunk
+//	event: done   data: {"status": "message added", "response": "...", "message": {...}, "citations": [...], "corners": [...]}
+//	event: error  data: {"status": "..."}
+//
+// The bot message is saved once the stream has finished.
+func (s *server) postToChatStream(c *gin.Context) {
+	turn := bindChatMessage(c)
+	if turn == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	turn.query = s.condenseQuery(ctx, turn)
+
+	embedding, err := s.embedQuery(ctx, turn.query)
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	matches := s.detectCorners(ctx, turn.query, embedding)
+
+	p := &prompt{}
+	if len(matches) == 0 {
+		p, err = s.buildPrompt(ctx, turn, embedding)
+		if err != nil {
+			c.JSON(500, gin.H{"status": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+
+	sendDelta := func(delta string) error {
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+		return ctx.Err()
+	}
+
+	var resp *llm.Response
+	if len(matches) > 0 {
+		resp = cornerAnswer(matches)
+		err = sendDelta(resp.Content)
+	} else {
+		resp, err = llm.Stream(ctx, s.completer(p.route), llm.Request{
+			Messages: p.messages,
+		}, sendDelta)
+	}
+	if err != nil {
+		c.SSEvent("error", gin.H{"status": err.Error()})
+		c.Writer.Flush()
+		return
+	}
+
+	botMsg, err := saveExchange(turn, p, resp)
+	if err != nil {
+		c.SSEvent("error", gin.H{"status": err.Error()})
+		c.Writer.Flush()
+		return
+	}
+	s.updateSummaryAsync(turn.chat.ID)
+
+	c.SSEvent("done", gin.H{"status": "message added", "response": resp.Content, "message": botMsg,
+		"citations": botMsg.Citations, "corners": corners.Names(matches)})
+	c.Writer.Flush()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/config"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// historyMessages turns chat messages into the conversation shown to the
+// helper prompts. Message rather than RealMessage is used: the latter holds
+// whole prompts with documents.
+func historyMessages(messages []db.ChatMessage) []templater.HistoryMessage {
+	history := make([]templater.HistoryMessage, 0, len(messages))
+	for _, m := range messages {
+		role := "Customer"
+		if m.IsBot {
+			role = "Assistant"
+		}
+		history = append(history, templater.HistoryMessage{Role: role, Content: m.Message})
+	}
+	return history
+}
+
+// chatSummary returns the summary of the chat, or nil when summaries are
+// disabled or the chat has none yet.
+func (s *server) chatSummary(chatID string) *db.Summary {
+	if !s.cfg.Summary.Enabled {
+		return nil
+	}
+
+	summary, err := db.GetSummary(chatID)
+	if err != nil {
+		if !errors.Is(err, db.ErrSummaryNotFound) {
+			log.Printf("chat %s: loading summary: %v", chatID, err)
+		}
+		return nil
+	}
+	return summary
+}
+
+// unsummarized returns the messages not covered by summary.
+func unsummarized(messages []db.ChatMessage, summary *db.Summary) []db.ChatMessage {
+	if summary == nil {
+		return messages
+	}
+	for i, m := range messages {
+		if m.ID > summary.LastMessageID {
+			return messages[i:]
+		}
+	}
+	return nil
+}
+
+// updateSummaryAsync updates the summary of the chat in the background once
+// enough turns are left out of it. At most one update per chat runs at a
+// time.
+func (s *server) updateSummaryAsync(chatID string) {
+	if !s.cfg.Summary.Enabled {
+		return
+	}
+	if _, running := s.summarizing.LoadOrStore(chatID, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer s.summarizing.Delete(chatID)
+
+		ctx := context.Background()
+		if s.cfg.Summary.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.cfg.Summary.Timeout)
+			defer cancel()
+		}
+
+		if err := s.updateSummary(ctx, chatID); err != nil {
+			log.Printf("chat %s: updating summary: %v", chatID, err)
+		}
+	}()
+}
+
+func (s *server) updateSummary(ctx context.Context, chatID string) error {
+	messages, err := db.GetChatMessages(chatID)
+	if err != nil {
+		return err
+	}
+
+	previous := s.chatSummary(chatID)
+	pending := unsummarized(messages, previous)
+
+	// Turns start at user messages; the latest Keep of them stay raw.
+	var turnStarts []int
+	for i, m := range pending {
+		if !m.IsBot {
+			turnStarts = append(turnStarts, i)
+		}
+	}
+	turns := len(turnStarts) - s.cfg.Summary.Keep
+	if turns <= 0 || turns < s.cfg.Summary.Every {
+		return nil
+	}
+	covered := pending
+	if turns < len(turnStarts) {
+		covered = pending[:turnStarts[turns]]
+	}
+
+	summary := &db.Summary{ChatID: chatID}
+	if previous != nil {
+		summary.Summary = previous.Summary
+		summary.Turns = previous.Turns
+	}
+
+	prompt, err := s.tmpl.ProcessTemplateSummary(summary.Summary, historyMessages(covered))
+	if err != nil {
+		return err
+	}
+
+	temperature := 0.0
+	resp, err := s.completer(config.RouteSummary).Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return err
+	}
+
+	summary.Summary = strings.TrimSpace(resp.Content)
+	summary.LastMessageID = covered[len(covered)-1].ID
+	summary.Turns += turns
+	summary.Model = resp.Model
+
+	return db.SaveSummary(summary)
+}
+
+func getChatSummary(c *gin.Context) {
+	chat := getChat(c)
+	if chat == nil {
+		return
+	}
+
+	summary, err := db.GetSummary(chat.ID)
+	if errors.Is(err, db.ErrSummaryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"status": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"status": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "summary": summary})
+}
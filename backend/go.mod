@@ -6,6 +6,7 @@ require (
 	github.com/gin-contrib/cors v1.4.0
 	github.com/gin-gonic/gin v1.9.1
 	github.com/mattn/go-sqlite3 v1.14.17
+	github.com/siriusfreak/hack-zurich-2023/lib v0.0.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -36,3 +37,5 @@ require (
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
+
+replace github.com/siriusfreak/hack-zurich-2023/lib => ../lib
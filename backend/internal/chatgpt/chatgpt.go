@@ -2,21 +2,31 @@ package chatgpt
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
 )
 
+const apiURL = "https://api.openai.com/v1/chat/completions"
+
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
 type RequestBody struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 }
 
 type ResponseMessage struct {
@@ -46,12 +56,16 @@ type Usage struct {
 }
 
 func CallAPI(requestBody RequestBody) (*ResponseBody, error) {
+	return CallAPIWithContext(context.Background(), requestBody)
+}
+
+func CallAPIWithContext(ctx context.Context, requestBody RequestBody) (*ResponseBody, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -65,15 +79,15 @@ func CallAPI(requestBody RequestBody) (*ResponseBody, error) {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("status code: " + resp.Status)
-	}
-
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
 	var responseBody ResponseBody
 	err = json.Unmarshal(body, &responseBody)
 	if err != nil {
@@ -82,3 +96,56 @@ func CallAPI(requestBody RequestBody) (*ResponseBody, error) {
 
 	return &responseBody, nil
 }
+
+// Client is the OpenAI implementation of llm.ChatCompleter.
+type Client struct {
+	Model string
+}
+
+func init() {
+	llm.Register("openai", func(model string) (llm.ChatCompleter, error) {
+		return NewClient(model), nil
+	})
+}
+
+func NewClient(model string) *Client {
+	return &Client{Model: model}
+}
+
+func (c *Client) Complete(ctx context.Context, request llm.Request) (*llm.Response, error) {
+	resp, err := CallAPIWithContext(ctx, c.requestBody(request))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("empty choices in response")
+	}
+
+	return toResponse(resp), nil
+}
+
+func (c *Client) requestBody(request llm.Request) RequestBody {
+	messages := make([]Message, 0, len(request.Messages))
+	for _, m := range request.Messages {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+
+	return RequestBody{
+		Model:       c.Model,
+		Messages:    messages,
+		Temperature: request.Temperature,
+		MaxTokens:   request.MaxTokens,
+	}
+}
+
+func toResponse(resp *ResponseBody) *llm.Response {
+	return &llm.Response{
+		Content: resp.Choices[0].Message.Content,
+		Model:   resp.Model,
+		Usage: llm.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+// APIError is a non-200 answer of the OpenAI API.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Status     string `json:"-"`
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// Body is the raw response body, kept when it is not an OpenAI error.
+	Body string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("openai: status %s: %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("openai: status %s: %s (%s)", e.Status, e.Message, e.Code)
+}
+
+// Unwrap lets errors.Is recognise prompts exceeding the model context.
+func (e *APIError) Unwrap() error {
+	if e.Code == "context_length_exceeded" {
+		return llm.ErrContextLengthExceeded
+	}
+	return nil
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+
+	var wrapper struct {
+		Error *APIError `json:"error"`
+	}
+	wrapper.Error = apiErr
+	if err := json.Unmarshal(body, &wrapper); err != nil || apiErr.Message == "" {
+		apiErr.Body = string(body)
+	}
+
+	return apiErr
+}
@@ -0,0 +1,135 @@
+package chatgpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type StreamDelta struct {
+	Content string `json:"content"`
+	Role    string `json:"role"`
+}
+
+type StreamChoice struct {
+	FinishReason string      `json:"finish_reason"`
+	Index        int         `json:"index"`
+	Delta        StreamDelta `json:"delta"`
+}
+
+// StreamChunk is one "data:" event of a streamed chat completion.
+type StreamChunk struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage"`
+}
+
+const streamDone = "[DONE]"
+
+// CallAPIStream calls the chat completions API with stream enabled. onDelta
+// receives every content delta as it arrives. The returned ResponseBody holds
+// the concatenated answer.
+func CallAPIStream(ctx context.Context, requestBody RequestBody, onDelta func(delta string) error) (*ResponseBody, error) {
+	requestBody.Stream = true
+	requestBody.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("CHAT_GPT_TOKEN"))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, newAPIError(resp, body)
+	}
+
+	result := ResponseBody{
+		Choices: []Choice{{Message: ResponseMessage{Role: "assistant"}}},
+	}
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == streamDone {
+			break
+		}
+
+		var chunk StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, err
+		}
+
+		result.ID = chunk.ID
+		result.Object = chunk.Object
+		result.Created = chunk.Created
+		result.Model = chunk.Model
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != "" {
+				result.Choices[0].FinishReason = choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result.Choices[0].Message.Content = content.String()
+	return &result, nil
+}
+
+func (c *Client) Stream(ctx context.Context, request llm.Request, onDelta func(delta string) error) (*llm.Response, error) {
+	resp, err := CallAPIStream(ctx, c.requestBody(request), onDelta)
+	if err != nil {
+		return nil, err
+	}
+	return toResponse(resp), nil
+}
@@ -0,0 +1,94 @@
+package citations
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// snippetLength bounds the passage returned with every citation, in runes.
+const snippetLength = 300
+
+// Citation is a document that went into the prompt of an answer. Number is
+// the [n] marker the model uses to refer to it.
+type Citation struct {
+	Number     int     `json:"number"`
+	DocumentID string  `json:"document_id"`
+	Url        string  `json:"url"`
+	Offset     int     `json:"offset"`
+	Page       int     `json:"page"`
+	Snippet    string  `json:"snippet"`
+	Score      float64 `json:"score"`
+	// Cited tells whether the answer refers to the document.
+	Cited bool `json:"cited"`
+}
+
+// FromDocuments returns the citations of the prompt documents, numbered in
+// prompt order like templater.NumberDocuments does.
+func FromDocuments(documents []templater.Document) []Citation {
+	citations := make([]Citation, 0, len(documents))
+	for i, d := range documents {
+		citations = append(citations, Citation{
+			Number:     i + 1,
+			DocumentID: d.ID,
+			Url:        d.Url,
+			Offset:     d.Offset,
+			Page:       d.Page,
+			Snippet:    snippet(d.Content),
+			Score:      d.Score,
+		})
+	}
+	return citations
+}
+
+// markerPattern matches [1] as well as grouped markers like [1, 3].
+var markerPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Markers returns the document numbers referred to in answer, in order of
+// first appearance.
+func Markers(answer string) []int {
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, m := range markerPattern.FindAllStringSubmatch(answer, -1) {
+		for _, field := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || seen[n] {
+				continue
+			}
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// Resolve marks the citations the answer refers to. Markers without a
+// matching citation are ignored.
+func Resolve(answer string, citations []Citation) []Citation {
+	for _, n := range Markers(answer) {
+		for i := range citations {
+			if citations[i].Number == n {
+				citations[i].Cited = true
+			}
+		}
+	}
+	return citations
+}
+
+// snippet shortens content to snippetLength runes on a word boundary and
+// collapses its whitespace.
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= snippetLength {
+		return content
+	}
+
+	cut := string(runes[:snippetLength])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "..."
+}
@@ -0,0 +1,75 @@
+package citations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+func TestMarkers(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   []int
+	}{
+		{answer: "No sources.", want: nil},
+		{answer: "Use Sikaflex [2].", want: []int{2}},
+		{answer: "Prime first [3], then seal [1]. Cure for a day [3].", want: []int{3, 1}},
+		{answer: "Both apply [1, 2] and [2,4].", want: []int{1, 2, 4}},
+		{answer: "Not markers: [a], [], [1;2] and [ 1 ].", want: nil},
+		{answer: "Nested [[5]] markers.", want: []int{5}},
+	}
+	for _, tt := range tests {
+		if got := Markers(tt.answer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Markers(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	documents := []templater.Document{
+		{ID: "a", Url: "/documents/a#page=1", Page: 1, Content: "Primer"},
+		{ID: "b", Url: "/documents/b#page=4", Page: 4, Content: "Sealant"},
+		{ID: "c", Url: "/documents/c#page=2", Page: 2, Content: "Curing"},
+	}
+
+	tests := []struct {
+		name      string
+		answer    string
+		wantCited []bool
+	}{
+		{name: "none", answer: "I do not know.", wantCited: []bool{false, false, false}},
+		{name: "some", answer: "Seal the joints [2] after priming [1].", wantCited: []bool{true, true, false}},
+		{name: "grouped", answer: "See [1, 3].", wantCited: []bool{true, false, true}},
+		{name: "unknown number", answer: "See [7].", wantCited: []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(tt.answer, FromDocuments(documents))
+			if len(got) != len(documents) {
+				t.Fatalf("got %d citations, want %d", len(got), len(documents))
+			}
+			for i, c := range got {
+				if c.Number != i+1 || c.DocumentID != documents[i].ID || c.Page != documents[i].Page {
+					t.Errorf("citation %d = %+v, want number %d of document %s", i, c, i+1, documents[i].ID)
+				}
+				if c.Cited != tt.wantCited[i] {
+					t.Errorf("citation %d: cited %v, want %v", c.Number, c.Cited, tt.wantCited[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	if got := snippet("  Apply\n\nthe   primer. "); got != "Apply the primer." {
+		t.Errorf("snippet() = %q", got)
+	}
+
+	long := snippet(strings.Repeat("membrane ", 100))
+	if len([]rune(long)) > snippetLength+3 || !strings.HasSuffix(long, "membrane...") {
+		t.Errorf("snippet() of a long text = %q, want at most %d runes cut at a word", long, snippetLength)
+	}
+}
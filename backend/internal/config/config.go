@@ -0,0 +1,257 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Route names used by the backend to pick an LLM.
+const (
+	RouteDefault      = "default"
+	RouteInitQuestion = "initQuestion"
+	RouteAllQuestions = "allQuestions"
+	RouteCorner       = "corner"
+	RouteRerank       = "rerank"
+	RouteCondense     = "condense"
+	RouteSummary      = "summary"
+)
+
+type Model struct {
+	Provider string `yaml:"provider"`
+	Model    string `yaml:"model"`
+}
+
+// Corner classification strategies.
+const (
+	CornersParallel   = "parallel"
+	CornersMultiLabel = "multilabel"
+	CornersEmbedding  = "embedding"
+)
+
+type Corners struct {
+	Enabled  bool          `yaml:"enabled"`
+	Strategy string        `yaml:"strategy"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// Threshold is the confidence used for corners without their own.
+	Threshold float64 `yaml:"threshold"`
+	// Similarity is the cosine similarity used by the embedding strategy for
+	// corners without their own.
+	Similarity float64 `yaml:"similarity"`
+	// EmbeddingCache is the file caching the embeddings of corner examples.
+	EmbeddingCache string `yaml:"embeddingCache"`
+}
+
+// Rerank strategies.
+const (
+	RerankNone    = "none"
+	RerankLLM     = "llm"
+	RerankLexical = "lexical"
+)
+
+// Rerank configures the stage choosing the context documents among the
+// retrieved candidates.
+type Rerank struct {
+	Strategy string `yaml:"strategy"`
+	// Candidates is how many documents are retrieved for reranking, 30 or
+	// the retrieval size when unset. It must not be less than the size.
+	Candidates int `yaml:"candidates"`
+	// MinScore in [0, 1] is the cutoff below which documents are dropped. When
+	// no document is left, the bot says it does not know.
+	MinScore float64       `yaml:"minScore"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// Document stores, see vectorstore.Config.
+const (
+	StoreElasticsearch = "elasticsearch"
+	StoreFlat          = "flat"
+)
+
+// Retrieval configures the document search feeding the prompts.
+type Retrieval struct {
+	// Store is elasticsearch or flat, an in-process store in the file at
+	// Path.
+	Store string `yaml:"store"`
+	// URL is the address of the Elasticsearch cluster holding Index.
+	URL   string `yaml:"url"`
+	Index string `yaml:"index"`
+	Path  string `yaml:"path"`
+	// Mode is knn, bm25, weighted or rrf, see vectorstore.Query.
+	Mode          string  `yaml:"mode"`
+	K             int     `yaml:"k"`
+	NumCandidates int     `yaml:"numCandidates"`
+	Size          int     `yaml:"size"`
+	TextWeight    float64 `yaml:"textWeight"`
+	VectorWeight  float64 `yaml:"vectorWeight"`
+	RankConstant  int     `yaml:"rankConstant"`
+	Rerank        Rerank  `yaml:"rerank"`
+}
+
+// Condense configures the rewriting of follow-up questions into standalone
+// ones before retrieval.
+type Condense struct {
+	Enabled bool `yaml:"enabled"`
+	// History is how many of the latest chat messages the rewrite sees.
+	History int           `yaml:"history"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Summary configures the running chat summaries replayed in place of the
+// older messages.
+type Summary struct {
+	Enabled bool `yaml:"enabled"`
+	// Every is how many new turns trigger an update of the summary.
+	Every int `yaml:"every"`
+	// Keep is how many of the latest turns stay out of the summary and are
+	// replayed as they are.
+	Keep    int           `yaml:"keep"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Context configures the token budget of the prompts sent to the LLMs.
+type Context struct {
+	// Windows is the context size in tokens per model name.
+	Windows map[string]int `yaml:"windows"`
+	// DefaultWindow is used for models missing from Windows.
+	DefaultWindow int `yaml:"defaultWindow"`
+	// Reserve is the part of the window kept free for the answer.
+	Reserve int `yaml:"reserve"`
+}
+
+// Budget returns how many tokens the prompt for model may use.
+func (c Context) Budget(model string) int {
+	window, ok := c.Windows[model]
+	if !ok {
+		window = c.DefaultWindow
+	}
+	return window - c.Reserve
+}
+
+// Documents configures the source PDFs served by the backend.
+type Documents struct {
+	// Root is scanned for PDFs at startup.
+	Root string `yaml:"root"`
+	// BaseURL is the public address of the backend used in document links.
+	// Links are relative to the backend when it is empty.
+	BaseURL string `yaml:"baseURL"`
+}
+
+// Embedding configures the model embedding the questions. It must be the
+// model pdfExtractor embedded the documents with.
+type Embedding struct {
+	// Provider is vertex or hashing, a local embedder needing no network.
+	Provider string `yaml:"provider"`
+	// Dimension declares the length of the vectors, see embedding.Config.
+	Dimension int    `yaml:"dimension"`
+	ProjectID string `yaml:"projectID"`
+	Region    string `yaml:"region"`
+	Model     string `yaml:"model"`
+	// Endpoint overrides the prediction API address of the region.
+	Endpoint string `yaml:"endpoint"`
+	// MaxInstances defaults to the number of texts the model accepts per
+	// request.
+	MaxInstances int           `yaml:"maxInstances"`
+	Retries      int           `yaml:"retries"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+type Config struct {
+	Routes    map[string]Model `yaml:"routes"`
+	Corners   Corners          `yaml:"corners"`
+	Retrieval Retrieval        `yaml:"retrieval"`
+	Condense  Condense         `yaml:"condense"`
+	Context   Context          `yaml:"context"`
+	Summary   Summary          `yaml:"summary"`
+	Documents Documents        `yaml:"documents"`
+	Embedding Embedding        `yaml:"embedding"`
+}
+
+func New(configFile string) (*Config, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	config := Config{
+		Retrieval: Retrieval{
+			Store:         StoreElasticsearch,
+			URL:           "https://hz.siriusfrk.me",
+			Index:         "sika_chat_index",
+			Mode:          "knn",
+			K:             10,
+			NumCandidates: 10,
+			Size:          3,
+			TextWeight:    1,
+			VectorWeight:  1,
+			Rerank: Rerank{
+				Strategy: RerankNone,
+			},
+		},
+		Condense: Condense{
+			History: 6,
+		},
+		Context: Context{
+			DefaultWindow: 4096,
+			Reserve:       512,
+		},
+		Summary: Summary{
+			Every: 4,
+			Keep:  1,
+		},
+		Embedding: Embedding{
+			ProjectID: "hackzurich23-8200",
+			Retries:   3,
+		},
+	}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	if _, ok := config.Routes[RouteDefault]; !ok {
+		return nil, fmt.Errorf("config has no %q route", RouteDefault)
+	}
+	if config.Retrieval.NumCandidates < config.Retrieval.K {
+		return nil, fmt.Errorf("retrieval numCandidates (%d) must not be less than k (%d)",
+			config.Retrieval.NumCandidates, config.Retrieval.K)
+	}
+	if rerank := &config.Retrieval.Rerank; rerank.Strategy != RerankNone && rerank.Strategy != "" {
+		if rerank.Candidates == 0 {
+			rerank.Candidates = 30
+			if rerank.Candidates < config.Retrieval.Size {
+				rerank.Candidates = config.Retrieval.Size
+			}
+		}
+		if rerank.Candidates < config.Retrieval.Size {
+			return nil, fmt.Errorf("retrieval rerank candidates (%d) must not be less than size (%d)",
+				rerank.Candidates, config.Retrieval.Size)
+		}
+	}
+
+	if config.Summary.Enabled && config.Summary.Every <= 0 {
+		return nil, fmt.Errorf("summary every must be positive, got %d", config.Summary.Every)
+	}
+	if config.Summary.Keep < 0 {
+		return nil, fmt.Errorf("summary keep must not be negative, got %d", config.Summary.Keep)
+	}
+	for route, m := range config.Routes {
+		if budget := config.Context.Budget(m.Model); budget <= 0 {
+			return nil, fmt.Errorf("route %s: context window of %s leaves no room for the prompt (budget %d)",
+				route, m.Model, budget)
+		}
+	}
+
+	return &config, nil
+}
+
+// Route returns the model configured for the route, falling back to the
+// default route for unknown names.
+func (c *Config) Route(name string) Model {
+	if m, ok := c.Routes[name]; ok {
+		return m
+	}
+	return c.Routes[RouteDefault]
+}
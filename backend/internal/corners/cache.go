@@ -0,0 +1,94 @@
+package corners
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// embeddingCache keeps embeddings of corner examples on disk so they are
+// computed once. Entries are keyed by the SHA-256 of the text; the whole
+// cache is dropped when the embedding model changes.
+type embeddingCache struct {
+	path    string
+	Model   string               `json:"model"`
+	Vectors map[string][]float64 `json:"vectors"`
+	dirty   bool
+}
+
+func loadEmbeddingCache(path string, model string) (*embeddingCache, error) {
+	cache := &embeddingCache{
+		path:    path,
+		Model:   model,
+		Vectors: make(map[string][]float64),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored embeddingCache
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored.Model == model && stored.Vectors != nil {
+		cache.Vectors = stored.Vectors
+	}
+
+	return cache, nil
+}
+
+func cacheKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *embeddingCache) get(text string) ([]float64, bool) {
+	v, ok := c.Vectors[cacheKey(text)]
+	return v, ok
+}
+
+func (c *embeddingCache) put(text string, vector []float64) {
+	c.Vectors[cacheKey(text)] = vector
+	c.dirty = true
+}
+
+// save writes the cache if it changed. The file is replaced atomically.
+func (c *embeddingCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
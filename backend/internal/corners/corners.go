@@ -0,0 +1,45 @@
+package corners
+
+import (
+	"context"
+	"strings"
+)
+
+// Match is a corner case the question falls into.
+type Match struct {
+	Name       string  `json:"name"`
+	Answer     string  `json:"answer"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Query is the question to classify. Embedding may be nil when it has not
+// been computed by the caller.
+type Query struct {
+	Text      string
+	Embedding []float64
+}
+
+// Classifier decides which corner cases a question falls into. Matches are
+// returned in configuration order. A non-nil error may come with the matches
+// that could still be decided.
+type Classifier interface {
+	Classify(ctx context.Context, query Query) ([]Match, error)
+}
+
+// Names returns the names of the matches.
+func Names(matches []Match) []string {
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Answer joins the canned answers of the matches.
+func Answer(matches []Match) string {
+	answers := make([]string, 0, len(matches))
+	for _, m := range matches {
+		answers = append(answers, m.Answer)
+	}
+	return strings.Join(answers, "\n\n")
+}
@@ -0,0 +1,131 @@
+package corners
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+	"github.com/siriusfreak/hack-zurich-2023/lib/embedding"
+)
+
+type cornerExamples struct {
+	corner   *templater.Corner
+	examples [][]float64
+}
+
+// Embedding matches a question to corners by cosine similarity between the
+// question embedding and the embeddings of the corner examples. It makes no
+// LLM call, and no embedding call either when the query embedding is given.
+type Embedding struct {
+	embedder          embedding.Embedder
+	corners           []cornerExamples
+	defaultSimilarity float64
+}
+
+// NewEmbedding embeds the examples of every corner, reusing the embeddings
+// cached in cachePath and storing the new ones there. The model of embedder
+// identifies the cache, so that a model change invalidates it.
+func NewEmbedding(tmpl *templater.Templater, embedder embedding.Embedder, cachePath string, defaultSimilarity float64) (*Embedding, error) {
+	cache, err := loadEmbeddingCache(cachePath, embedder.Model())
+	if err != nil {
+		return nil, fmt.Errorf("loading corner embedding cache: %w", err)
+	}
+
+	var missing []string
+	for _, corner := range tmpl.Corners {
+		for _, example := range corner.Examples {
+			if _, ok := cache.get(example); !ok {
+				missing = append(missing, example)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		vectors, err := embedder.Embed(context.Background(), missing)
+		if err != nil {
+			return nil, fmt.Errorf("embedding %d corner examples: %w", len(missing), err)
+		}
+		for i, example := range missing {
+			cache.put(example, vectors[i])
+		}
+	}
+
+	e := &Embedding{
+		embedder:          embedder,
+		defaultSimilarity: defaultSimilarity,
+	}
+	for _, corner := range tmpl.Corners {
+		ce := cornerExamples{corner: corner}
+		for _, example := range corner.Examples {
+			vector, _ := cache.get(example)
+			ce.examples = append(ce.examples, vector)
+		}
+		e.corners = append(e.corners, ce)
+	}
+
+	if err := cache.save(); err != nil {
+		return nil, fmt.Errorf("saving corner embedding cache: %w", err)
+	}
+
+	return e, nil
+}
+
+func (e *Embedding) Classify(ctx context.Context, query Query) ([]Match, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	vector := query.Embedding
+	if vector == nil {
+		vectors, err := e.embedder.Embed(ctx, []string{query.Text})
+		if err != nil {
+			return nil, err
+		}
+		vector = vectors[0]
+	}
+
+	var matches []Match
+	for _, ce := range e.corners {
+		best := -1.0
+		for _, example := range ce.examples {
+			if similarity := cosine(vector, example); similarity > best {
+				best = similarity
+			}
+		}
+
+		threshold := ce.corner.Similarity
+		if threshold == 0 {
+			threshold = e.defaultSimilarity
+		}
+		if len(ce.examples) == 0 || best < threshold {
+			continue
+		}
+
+		matches = append(matches, Match{
+			Name:       ce.corner.Name,
+			Answer:     strings.TrimSpace(ce.corner.Answer),
+			Confidence: best,
+		})
+	}
+
+	return matches, nil
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
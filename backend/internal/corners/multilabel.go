@@ -0,0 +1,139 @@
+package corners
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// Label is one entry of the classifier output.
+type Label struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+type classifierOutput struct {
+	Labels []Label `json:"labels"`
+}
+
+// MultiLabel classifies a question into all corners with a single LLM call.
+// The model answers with JSON labels and confidences, which are checked
+// against the configured corners and their thresholds.
+type MultiLabel struct {
+	tmpl             *templater.Templater
+	completer        llm.ChatCompleter
+	timeout          time.Duration
+	defaultThreshold float64
+}
+
+func NewMultiLabel(tmpl *templater.Templater, completer llm.ChatCompleter, timeout time.Duration, defaultThreshold float64) *MultiLabel {
+	return &MultiLabel{
+		tmpl:             tmpl,
+		completer:        completer,
+		timeout:          timeout,
+		defaultThreshold: defaultThreshold,
+	}
+}
+
+func (m *MultiLabel) Classify(ctx context.Context, query Query) ([]Match, error) {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	prompt, err := m.tmpl.ProcessTemplateClassifier(query.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	temperature := 0.0
+	resp, err := m.completer.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := ParseLabels(resp.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.matches(labels)
+}
+
+// matches keeps the labels naming a configured corner with a confidence
+// reaching its threshold. Invalid labels are reported in the error.
+func (m *MultiLabel) matches(labels []Label) ([]Match, error) {
+	confidences := make(map[string]float64, len(labels))
+	var errs []error
+	for _, l := range labels {
+		if _, err := m.tmpl.GetCorner(l.Name); err != nil {
+			errs = append(errs, fmt.Errorf("unknown corner %q in classifier output", l.Name))
+			continue
+		}
+		if l.Confidence < 0 || l.Confidence > 1 {
+			errs = append(errs, fmt.Errorf("corner %s: confidence %v out of [0, 1]", l.Name, l.Confidence))
+			continue
+		}
+		if l.Confidence > confidences[l.Name] {
+			confidences[l.Name] = l.Confidence
+		}
+	}
+
+	var matches []Match
+	for _, corner := range m.tmpl.Corners {
+		confidence, ok := confidences[corner.Name]
+		if !ok {
+			continue
+		}
+
+		threshold := corner.Threshold
+		if threshold == 0 {
+			threshold = m.defaultThreshold
+		}
+		if confidence < threshold {
+			continue
+		}
+
+		matches = append(matches, Match{
+			Name:       corner.Name,
+			Answer:     strings.TrimSpace(corner.Answer),
+			Confidence: confidence,
+		})
+	}
+
+	return matches, errors.Join(errs...)
+}
+
+// ParseLabels extracts the labels from the classifier answer. Models tend to
+// wrap JSON in code fences or prose, so the outermost object is used.
+func ParseLabels(content string) ([]Label, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in classifier output %q", content)
+	}
+
+	var output classifierOutput
+	decoder := json.NewDecoder(strings.NewReader(content[start : end+1]))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&output); err != nil {
+		return nil, fmt.Errorf("parsing classifier output: %w", err)
+	}
+
+	return output.Labels, nil
+}
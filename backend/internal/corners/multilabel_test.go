@@ -0,0 +1,137 @@
+package corners
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Label
+		wantErr bool
+	}{
+		{
+			name:    "plain",
+			content: `{"labels": [{"name": "price", "confidence": 0.9}]}`,
+			want:    []Label{{Name: "price", Confidence: 0.9}},
+		},
+		{
+			name:    "code fence",
+			content: "```json\n{\"labels\": [{\"name\": \"price\", \"confidence\": 0.9}, {\"name\": \"competitors\", \"confidence\": 0.2}]}\n```",
+			want:    []Label{{Name: "price", Confidence: 0.9}, {Name: "competitors", Confidence: 0.2}},
+		},
+		{
+			name:    "prose around",
+			content: `Sure! Here you go: {"labels": []} Hope this helps.`,
+			want:    []Label{},
+		},
+		{
+			name:    "no labels",
+			content: `{}`,
+			want:    nil,
+		},
+		{name: "no object", content: "price", wantErr: true},
+		{name: "unknown field", content: `{"corners": ["price"]}`, wantErr: true},
+		{name: "bad confidence", content: `{"labels": [{"name": "price", "confidence": "high"}]}`, wantErr: true},
+		{name: "truncated", content: `{"labels": [{"name": "price"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.content)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseLabels() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLabels() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// answer is a completer always answering with itself.
+type answer string
+
+func (a answer) Complete(ctx context.Context, request llm.Request) (*llm.Response, error) {
+	return &llm.Response{Content: string(a)}, nil
+}
+
+func TestMultiLabelClassify(t *testing.T) {
+	tmpl := &templater.Templater{
+		Classifier: "Classify {{.Question}}",
+		Corners: []*templater.Corner{
+			{Name: "price", Answer: "Ask your dealer. "},
+			{Name: "competitors", Answer: "We only talk about Sika.", Threshold: 0.9},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "above default threshold",
+			output: `{"labels": [{"name": "price", "confidence": 0.8}]}`,
+			want:   []string{"price"},
+		},
+		{
+			name:   "below own threshold",
+			output: `{"labels": [{"name": "price", "confidence": 0.6}, {"name": "competitors", "confidence": 0.8}]}`,
+			want:   []string{"price"},
+		},
+		{
+			name:   "configuration order",
+			output: `{"labels": [{"name": "competitors", "confidence": 0.95}, {"name": "price", "confidence": 0.7}]}`,
+			want:   []string{"price", "competitors"},
+		},
+		{
+			name:   "below default threshold",
+			output: `{"labels": [{"name": "price", "confidence": 0.4}]}`,
+			want:   []string{},
+		},
+		{
+			name:    "unknown corner",
+			output:  `{"labels": [{"name": "weather", "confidence": 1}, {"name": "price", "confidence": 1}]}`,
+			want:    []string{"price"},
+			wantErr: true,
+		},
+		{
+			name:    "confidence out of range",
+			output:  `{"labels": [{"name": "price", "confidence": 1.5}]}`,
+			want:    []string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMultiLabel(tmpl, answer(tt.output), 0, 0.5)
+			matches, err := m.Classify(context.Background(), Query{Text: "How much is Sikaflex?"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Classify() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := Names(matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Classify() = %v, want %v", got, tt.want)
+			}
+			for _, match := range matches {
+				if match.Name == "price" && match.Answer != "Ask your dealer." {
+					t.Errorf("answer %q, want it trimmed", match.Answer)
+				}
+			}
+		})
+	}
+}
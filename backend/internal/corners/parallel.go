@@ -0,0 +1,120 @@
+package corners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// Parallel asks the LLM a YES/NO question for every corner of the templates,
+// all of them concurrently.
+type Parallel struct {
+	tmpl      *templater.Templater
+	completer llm.ChatCompleter
+	timeout   time.Duration
+}
+
+func NewParallel(tmpl *templater.Templater, completer llm.ChatCompleter, timeout time.Duration) *Parallel {
+	return &Parallel{
+		tmpl:      tmpl,
+		completer: completer,
+		timeout:   timeout,
+	}
+}
+
+type result struct {
+	index int
+	match *Match
+	err   error
+}
+
+// Classify runs one classifier per corner. All classifiers share one
+// deadline; classifiers still running when it expires are cancelled. Errors
+// of individual corners are joined into the returned error.
+func (d *Parallel) Classify(ctx context.Context, query Query) ([]Match, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	names := d.tmpl.GetCornerNames()
+	results := make(chan result, len(names))
+	wg := &sync.WaitGroup{}
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			match, err := d.detectCorner(ctx, name, query.Text)
+			if err != nil {
+				err = fmt.Errorf("corner %s: %w", name, err)
+			}
+			results <- result{index: i, match: match, err: err}
+		}(i, name)
+	}
+
+	wg.Wait()
+	close(results)
+
+	ordered := make([]*Match, len(names))
+	var errs []error
+	for r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		ordered[r.index] = r.match
+	}
+
+	var matches []Match
+	for _, m := range ordered {
+		if m != nil {
+			matches = append(matches, *m)
+		}
+	}
+
+	return matches, errors.Join(errs...)
+}
+
+func (d *Parallel) detectCorner(ctx context.Context, name string, question string) (*Match, error) {
+	prompt, err := d.tmpl.GetCornerQuestion(name, question)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.completer.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompt,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !isYes(resp.Content) {
+		return nil, nil
+	}
+
+	answer, err := d.tmpl.GetCornerResponse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Match{Name: name, Answer: strings.TrimSpace(answer), Confidence: 1}, nil
+}
+
+// isYes reports whether the model answered YES, tolerating case, whitespace
+// and trailing punctuation.
+func isYes(content string) bool {
+	content = strings.ToUpper(strings.TrimSpace(content))
+	return strings.TrimRight(content, ".!") == "YES"
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/retrieval"
+)
+
+var ErrChatNotFound = errors.New("chat not found")
+
+type Chat struct {
+	ID        string    `json:"chat_id"`
+	Title     string    `json:"title"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Filters narrow the documents retrieved for every message of the chat.
+	Filters retrieval.Filter `json:"filters"`
+}
+
+const chatColumns = "id, title, owner, created_at, updated_at, filters"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChat(row rowScanner) (*Chat, error) {
+	var chat Chat
+	var filters string
+	err := row.Scan(&chat.ID, &chat.Title, &chat.Owner, &chat.CreatedAt, &chat.UpdatedAt, &filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(filters), &chat.Filters); err != nil {
+		return nil, err
+	}
+
+	return &chat, nil
+}
+
+// maxTitleLength bounds titles derived from the first message of a chat.
+// Migration 0009 applies it to the titles of migrated chats.
+const maxTitleLength = 80
+
+// newChatID returns a random opaque chat ID.
+func newChatID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateChat allocates a new chat. An empty title is filled in from the first
+// user message.
+func CreateChat(title string, owner string, filters retrieval.Filter) (*Chat, error) {
+	id, err := newChatID()
+	if err != nil {
+		return nil, err
+	}
+
+	filtersJSON, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	chat := &Chat{
+		ID:        id,
+		Title:     title,
+		Owner:     owner,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Filters:   filters,
+	}
+
+	_, err = DB.Exec("INSERT INTO chats (id, title, owner, created_at, updated_at, filters) VALUES (?, ?, ?, ?, ?, ?)",
+		chat.ID, chat.Title, chat.Owner, chat.CreatedAt, chat.UpdatedAt, string(filtersJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	return chat, nil
+}
+
+func GetChat(chatID string) (*Chat, error) {
+	chat, err := scanChat(DB.QueryRow("SELECT "+chatColumns+" FROM chats WHERE id = ?", chatID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChatNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return chat, nil
+}
+
+// UpdateChat changes the title and the filters of a chat. Nil arguments are
+// left unchanged.
+func UpdateChat(chatID string, title *string, filters *retrieval.Filter) (*Chat, error) {
+	if title != nil {
+		if _, err := DB.Exec("UPDATE chats SET title = ? WHERE id = ?", *title, chatID); err != nil {
+			return nil, err
+		}
+	}
+
+	if filters != nil {
+		filtersJSON, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := DB.Exec("UPDATE chats SET filters = ? WHERE id = ?", string(filtersJSON), chatID); err != nil {
+			return nil, err
+		}
+	}
+
+	return GetChat(chatID)
+}
+
+// ListChats returns the chats of owner, or all chats for an empty owner, most
+// recently active first.
+func ListChats(owner string) ([]Chat, error) {
+	query := "SELECT " + chatColumns + " FROM chats"
+	var args []interface{}
+	if owner != "" {
+		query += " WHERE owner = ?"
+		args = append(args, owner)
+	}
+	query += " ORDER BY updated_at DESC, id"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := []Chat{}
+	for rows.Next() {
+		chat, err := scanChat(rows)
+		if err != nil {
+			return nil, err
+		}
+		chats = append(chats, *chat)
+	}
+
+	return chats, rows.Err()
+}
+
+// touchChat bumps the last activity of a chat and gives untitled chats the
+// text of their first user message as title.
+func touchChat(tx *sql.Tx, msg *ChatMessage) error {
+	title := ""
+	if !msg.IsBot {
+		title = truncateTitle(msg.Message)
+	}
+
+	res, err := tx.Exec(`
+		UPDATE chats 
+		SET updated_at = ?, title = CASE WHEN title = '' THEN ? ELSE title END 
+		WHERE id = ?`, msg.CreatedAt, title, msg.ChatID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrChatNotFound
+	}
+
+	return nil
+}
+
+func truncateTitle(message string) string {
+	runes := []rune(message)
+	if len(runes) <= maxTitleLength {
+		return message
+	}
+	return string(runes[:maxTitleLength]) + "..."
+}
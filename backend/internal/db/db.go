@@ -2,99 +2,146 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/citations"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
 )
 
 var DB *sql.DB
 
 type ChatMessage struct {
 	ID          int    `json:"id"`
-	ChatID      int    `json:"chat_id"`
+	ChatID      string `json:"chat_id"`
 	Message     string `json:"message"`
 	IsBot       bool   `json:"is_bot"`
 	Language    string `json:"language"`
 	RealMessage string `json:"real_message"`
+	// RewrittenQuery is the standalone question retrieval used for a
+	// follow-up user message.
+	RewrittenQuery string    `json:"rewritten_query"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Model and Usage are only set on bot messages.
+	Model       string    `json:"model"`
+	Usage       llm.Usage `json:"usage"`
+	DocumentIDs []string  `json:"document_ids"`
+	// Citations are only set on bot messages.
+	Citations []citations.Citation `json:"citations"`
 }
 
+// InitDB opens the database and brings its schema up to date.
 func InitDB(dataSourceName string) error {
-	var err error
-	DB, err = sql.Open("sqlite3", dataSourceName)
+	err := Open(dataSourceName)
 	if err != nil {
 		return err
 	}
 
-	_, err = DB.Exec(`CREATE TABLE IF NOT EXISTS chat_history 
-		(id INTEGER PRIMARY KEY, 
-		chat_id INTEGER, 
-		message TEXT, 
-		is_bot BOOLEAN, 
-		real_message TEXT)
-	`)
+	return Migrate()
+}
 
+// Open opens the database without touching its schema.
+func Open(dataSourceName string) error {
+	var err error
+	DB, err = sql.Open("sqlite3", dataSourceName)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return DB.Ping()
 }
 
-type ChatInfo struct {
-	ChatID int    `json:"chat_id"`
-	Name   string `json:"name"`
-}
-
-func GetChatIDs() ([]ChatInfo, error) {
+func GetChatMessages(chatID string) ([]ChatMessage, error) {
 	rows, err := DB.Query(`
-        SELECT 
-            ch1.chat_id, 
-            ch2.message AS name 
-        FROM 
-            (SELECT chat_id FROM chat_history GROUP BY chat_id) AS ch1 
-        JOIN 
-            chat_history AS ch2 
-        ON 
-            ch1.chat_id = ch2.chat_id 
-        WHERE 
-            ch2.id IN (SELECT MIN(id) FROM chat_history GROUP BY chat_id)
-    `)
+		SELECT 
+			id, chat_id, message, is_bot, real_message, language, created_at, 
+			model, prompt_tokens, completion_tokens, total_tokens, document_ids, rewritten_query, 
+			citations 
+		FROM chat_history 
+		WHERE chat_id = ? 
+		ORDER BY id`, chatID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var chatInfos []ChatInfo
+	var messages []ChatMessage
 	for rows.Next() {
-		var info ChatInfo
-		if err := rows.Scan(&info.ChatID, &info.Name); err != nil {
+		var msg ChatMessage
+		var createdAt sql.NullTime
+		var documentIDs, citationsJSON string
+		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.Message, &msg.IsBot, &msg.RealMessage,
+			&msg.Language, &createdAt, &msg.Model, &msg.Usage.PromptTokens,
+			&msg.Usage.CompletionTokens, &msg.Usage.TotalTokens, &documentIDs, &msg.RewrittenQuery,
+			&citationsJSON); err != nil {
+			return nil, err
+		}
+		msg.CreatedAt = createdAt.Time
+		if err := json.Unmarshal([]byte(documentIDs), &msg.DocumentIDs); err != nil {
 			return nil, err
 		}
-		chatInfos = append(chatInfos, info)
+		if err := json.Unmarshal([]byte(citationsJSON), &msg.Citations); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
 	}
 
-	return chatInfos, nil
+	return messages, rows.Err()
 }
 
-func GetChatMessages(chatID int) ([]ChatMessage, error) {
-	rows, err := DB.Query("SELECT id, chat_id, message, is_bot, real_message FROM chat_history WHERE chat_id = ?", chatID)
+// InsertChatMessage stores msg and fills in its ID and, when unset, its
+// creation time. The chat must exist; its last activity time is updated.
+func InsertChatMessage(msg *ChatMessage) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	if msg.DocumentIDs == nil {
+		msg.DocumentIDs = []string{}
+	}
+	if msg.Citations == nil {
+		msg.Citations = []citations.Citation{}
+	}
+
+	documentIDs, err := json.Marshal(msg.DocumentIDs)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	citationsJSON, err := json.Marshal(msg.Citations)
+	if err != nil {
+		return err
 	}
-	defer rows.Close()
 
-	var messages []ChatMessage
-	for rows.Next() {
-		var msg ChatMessage
-		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.Message, &msg.IsBot, &msg.RealMessage); err != nil {
-			return nil, err
-		}
-		messages = append(messages, msg)
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return messages, nil
-}
+	err = touchChat(tx, msg)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO chat_history 
+			(chat_id, message, real_message, is_bot, language, created_at, 
+			model, prompt_tokens, completion_tokens, total_tokens, document_ids, rewritten_query, 
+			citations) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.ChatID, msg.Message, msg.RealMessage, msg.IsBot, msg.Language, msg.CreatedAt,
+		msg.Model, msg.Usage.PromptTokens, msg.Usage.CompletionTokens, msg.Usage.TotalTokens, string(documentIDs),
+		msg.RewrittenQuery, string(citationsJSON))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	msg.ID = int(id)
 
-func InsertChatMessage(chatID int, message string, realMessage string, isBot bool) error {
-	_, err := DB.Exec("INSERT INTO chat_history (chat_id, message, real_message, is_bot) VALUES (?, ?, ?, ?)", chatID, message, realMessage, isBot)
-	return err
+	return tx.Commit()
 }
 
 func CloseDB() {
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+// Document is a source PDF known to the backend.
+type Document struct {
+	ID string `json:"id"`
+	// Path is where the file is read from; it is not exposed.
+	Path string `json:"-"`
+	// SourceFile is the path relative to the document root, as indexed by
+	// pdfExtractor.
+	SourceFile   string    `json:"source_file"`
+	Size         int64     `json:"size"`
+	ModifiedAt   time.Time `json:"modified_at"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+const documentColumns = "id, path, source_file, size, modified_at, registered_at"
+
+func scanDocument(row rowScanner) (*Document, error) {
+	var d Document
+	err := row.Scan(&d.ID, &d.Path, &d.SourceFile, &d.Size, &d.ModifiedAt, &d.RegisteredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// RegisterDocument adds d to the registry or updates the entry with its ID.
+// Documents registered before with the same path and another ID are
+// removed: the file changed and their content is gone.
+func RegisterDocument(d *Document) error {
+	if d.RegisteredAt.IsZero() {
+		d.RegisteredAt = time.Now().UTC()
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO documents (`+documentColumns+`) 
+		VALUES (?, ?, ?, ?, ?, ?) 
+		ON CONFLICT (id) DO UPDATE SET 
+			path = excluded.path, 
+			source_file = excluded.source_file, 
+			size = excluded.size, 
+			modified_at = excluded.modified_at`,
+		d.ID, d.Path, d.SourceFile, d.Size, d.ModifiedAt, d.RegisteredAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM documents WHERE path = ? AND id != ?", d.Path, d.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func GetDocument(id string) (*Document, error) {
+	return scanDocument(DB.QueryRow("SELECT "+documentColumns+" FROM documents WHERE id = ?", id))
+}
+
+// GetDocumentByPath returns the latest registered document read from path.
+func GetDocumentByPath(path string) (*Document, error) {
+	return scanDocument(DB.QueryRow("SELECT "+documentColumns+
+		" FROM documents WHERE path = ? ORDER BY registered_at DESC LIMIT 1", path))
+}
+
+// GetDocumentBySourceFile returns the latest registered document with the
+// source file name. It links chunks indexed before documents had IDs.
+func GetDocumentBySourceFile(sourceFile string) (*Document, error) {
+	return scanDocument(DB.QueryRow("SELECT "+documentColumns+
+		" FROM documents WHERE source_file = ? ORDER BY registered_at DESC LIMIT 1", sourceFile))
+}
+
+func ListDocuments() ([]Document, error) {
+	rows, err := DB.Query("SELECT " + documentColumns + " FROM documents ORDER BY source_file, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, *d)
+	}
+
+	return documents, rows.Err()
+}
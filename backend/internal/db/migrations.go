@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/ as NNNN_description.sql and are applied in
+// version order. Never edit a released migration, add a new file instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must look like NNNN_description.sql", fileName)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version %q", fileName, prefix)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, fileName, version)
+		}
+		seen[version] = fileName
+
+		data, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{
+			version: version,
+			name:    strings.ReplaceAll(name, "_", " "),
+			sql:     string(data),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+func ensureSchemaVersionTable() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_version 
+		(version INTEGER PRIMARY KEY, 
+		name TEXT, 
+		applied_at TIMESTAMP)
+	`)
+	return err
+}
+
+// SchemaVersion returns the version of the last applied migration, 0 for an
+// empty database.
+func SchemaVersion() (int, error) {
+	if err := ensureSchemaVersionTable(); err != nil {
+		return 0, err
+	}
+
+	var current int
+	err := DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	return current, err
+}
+
+// Migrate applies all pending migrations.
+func Migrate() error {
+	return MigrateTo(0)
+}
+
+// MigrateTo applies pending migrations up to and including version target.
+// A target of 0 means the latest version.
+func MigrateTo(target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) > 0 && current > migrations[len(migrations)-1].version {
+		return fmt.Errorf("database schema version %d is newer than this binary (%d)",
+			current, migrations[len(migrations)-1].version)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if target > 0 && m.version > target {
+			break
+		}
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// GetMigrationStatus lists every known migration and when it was applied.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureSchemaVersionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt.Time
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if t, ok := applied[m.version]; ok {
+			t := t
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := execMigration(tx, m); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func execMigration(tx *sql.Tx, m migration) error {
+	_, err := tx.Exec(m.sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS chat_history
+	(id INTEGER PRIMARY KEY,
+	chat_id INTEGER,
+	message TEXT,
+	is_bot BOOLEAN,
+	real_message TEXT);
@@ -0,0 +1,7 @@
+ALTER TABLE chat_history ADD COLUMN language TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_history ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE chat_history ADD COLUMN model TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_history ADD COLUMN prompt_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_history ADD COLUMN completion_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_history ADD COLUMN total_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_history ADD COLUMN document_ids TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,51 @@
+CREATE TABLE chats
+	(id TEXT PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	owner TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL);
+
+CREATE INDEX chats_owner_updated_at ON chats (owner, updated_at);
+CREATE INDEX chats_updated_at ON chats (updated_at);
+
+-- Chats created before this migration only exist as groups of chat_history
+-- rows with a client chosen integer id. Keep those ids, as text.
+INSERT INTO chats (id, title, owner, created_at, updated_at)
+	SELECT
+		CAST(h.chat_id AS TEXT),
+		COALESCE((SELECT first.message FROM chat_history AS first
+			WHERE first.chat_id = h.chat_id ORDER BY first.id LIMIT 1), ''),
+		'',
+		COALESCE(MIN(h.created_at), CURRENT_TIMESTAMP),
+		COALESCE(MAX(h.created_at), CURRENT_TIMESTAMP)
+	FROM chat_history AS h
+	GROUP BY h.chat_id;
+
+-- SQLite cannot change a column type in place, so chat_history is rebuilt
+-- with a TEXT chat_id referencing chats.
+CREATE TABLE chat_history_new
+	(id INTEGER PRIMARY KEY,
+	chat_id TEXT NOT NULL REFERENCES chats (id),
+	message TEXT,
+	is_bot BOOLEAN,
+	real_message TEXT,
+	language TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP,
+	model TEXT NOT NULL DEFAULT '',
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	total_tokens INTEGER NOT NULL DEFAULT 0,
+	document_ids TEXT NOT NULL DEFAULT '[]');
+
+INSERT INTO chat_history_new
+	(id, chat_id, message, is_bot, real_message, language, created_at,
+	model, prompt_tokens, completion_tokens, total_tokens, document_ids)
+	SELECT
+		id, CAST(chat_id AS TEXT), message, is_bot, real_message, language, created_at,
+		model, prompt_tokens, completion_tokens, total_tokens, document_ids
+	FROM chat_history;
+
+DROP TABLE chat_history;
+ALTER TABLE chat_history_new RENAME TO chat_history;
+
+CREATE INDEX chat_history_chat_id ON chat_history (chat_id, id);
@@ -0,0 +1,2 @@
+-- Retrieval filters narrowing a chat to e.g. one product line, as JSON.
+ALTER TABLE chats ADD COLUMN filters TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- Standalone question a follow-up was rewritten into for retrieval. Empty when
+-- the message was used as is.
+ALTER TABLE chat_history ADD COLUMN rewritten_query TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Running summary of a chat. It covers the messages up to and including
+-- last_message_id; later ones are replayed as they are.
+CREATE TABLE chat_summaries
+	(chat_id TEXT PRIMARY KEY REFERENCES chats (id),
+	summary TEXT NOT NULL,
+	last_message_id INTEGER NOT NULL,
+	turns INTEGER NOT NULL,
+	model TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMP NOT NULL);
@@ -0,0 +1,3 @@
+-- Documents that went into the prompt of a bot message, as JSON, with the
+-- ones the answer cites marked.
+ALTER TABLE chat_history ADD COLUMN citations TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,12 @@
+-- Registry of the source PDFs served by GET /documents/:id. The ID is the
+-- SHA-256 of the file content, as indexed by pdfExtractor.
+CREATE TABLE documents
+	(id TEXT PRIMARY KEY,
+	path TEXT NOT NULL,
+	source_file TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	modified_at TIMESTAMP NOT NULL,
+	registered_at TIMESTAMP NOT NULL);
+
+CREATE INDEX documents_source_file ON documents (source_file);
+CREATE INDEX documents_path ON documents (path);
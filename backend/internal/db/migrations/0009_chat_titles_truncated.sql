@@ -0,0 +1,8 @@
+-- Chats migrated by 0003 took their whole first message as title. Cut those
+-- titles like truncateTitle does for new chats (maxTitleLength = 80).
+-- Titles a user has set are left alone.
+UPDATE chats
+	SET title = substr(title, 1, 80) || '...'
+	WHERE length(title) > 80
+		AND title = (SELECT first.message FROM chat_history AS first
+			WHERE first.chat_id = chats.id ORDER BY first.id LIMIT 1);
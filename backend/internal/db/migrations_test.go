@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// legacySchema is the chat_history table created by the backend before
+// migrations existed.
+const legacySchema = `CREATE TABLE IF NOT EXISTS chat_history 
+	(id INTEGER PRIMARY KEY, 
+	chat_id INTEGER, 
+	message TEXT, 
+	is_bot BOOLEAN, 
+	real_message TEXT)`
+
+func openLegacyDB(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.db")
+
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{
+		legacySchema,
+		`INSERT INTO chat_history (chat_id, message, is_bot, real_message) VALUES
+			(1, 'How do I seal a joint in concrete?', 0, 'Template: How do I seal a joint in concrete?'),
+			(1, 'Use Sikaflex.', 1, ''),
+			(1, 'And how long does it cure?', 0, ''),
+			(2, '` + strings.Repeat("é", 100) + `', 0, ''),
+			(2, 'I do not know.', 1, '')`,
+	}
+	for _, s := range statements {
+		if _, err := legacy.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	legacy.Close()
+
+	if err := Open(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseDB)
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	openLegacyDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].version
+
+	// Step through every version, as a deployment updated release by release
+	// would.
+	for _, m := range migrations {
+		if err := MigrateTo(m.version); err != nil {
+			t.Fatalf("migrating to %d: %v", m.version, err)
+		}
+		if version, err := SchemaVersion(); err != nil || version != m.version {
+			t.Fatalf("schema version %d (%v), want %d", version, err, m.version)
+		}
+	}
+	if err := Migrate(); err != nil {
+		t.Fatalf("migrating an up to date database: %v", err)
+	}
+
+	status, err := GetMigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != latest {
+		t.Fatalf("%d migrations listed, want %d", len(status), latest)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d (%s) not applied", s.Version, s.Name)
+		}
+	}
+
+	rows, err := DB.Query("SELECT message, is_bot, real_message FROM chat_history WHERE chat_id = '1' ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		message     string
+		isBot       bool
+		realMessage string
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.message, &r.isBot, &r.realMessage); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []row{
+		{"How do I seal a joint in concrete?", false, "Template: How do I seal a joint in concrete?"},
+		{"Use Sikaflex.", true, ""},
+		{"And how long does it cure?", false, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chat 1 after migration = %+v, want %+v", got, want)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	openLegacyDB(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("INSERT INTO schema_version (version, name) VALUES (9999, 'future')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err == nil {
+		t.Error("Migrate() accepted a schema newer than the binary")
+	}
+}
+
+func TestMigrateLegacyChats(t *testing.T) {
+	openLegacyDB(t)
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	chats, err := ListChats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make(map[string]string)
+	for _, c := range chats {
+		titles[c.ID] = c.Title
+	}
+	want := map[string]string{
+		"1": "How do I seal a joint in concrete?",
+		"2": truncateTitle(strings.Repeat("é", 100)),
+	}
+	for id, title := range want {
+		if titles[id] != title {
+			t.Errorf("chat %s: title %q, want %q", id, titles[id], title)
+		}
+	}
+	if len(chats) != len(want) {
+		t.Errorf("%d chats, want %d", len(chats), len(want))
+	}
+
+	messages, err := GetChatMessages("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("%d messages in chat 1, want 3", len(messages))
+	}
+	first := messages[0]
+	if first.ChatID != "1" || first.IsBot || first.RealMessage != "Template: How do I seal a joint in concrete?" ||
+		first.DocumentIDs == nil || first.Citations == nil {
+		t.Errorf("first message = %+v", first)
+	}
+	if !messages[1].IsBot || messages[1].Message != "Use Sikaflex." {
+		t.Errorf("second message = %+v", messages[1])
+	}
+
+	// The migrated chats take new messages.
+	msg := ChatMessage{ChatID: "1", Message: "Thanks!", Language: "en"}
+	if err := InsertChatMessage(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if messages, err := GetChatMessages("1"); err != nil || len(messages) != 4 {
+		t.Errorf("%d messages after insert (%v), want 4", len(messages), err)
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSummaryNotFound = errors.New("chat has no summary")
+
+// Summary is the running summary of a chat.
+type Summary struct {
+	ChatID  string `json:"chat_id"`
+	Summary string `json:"summary"`
+	// LastMessageID is the ID of the last message the summary covers.
+	LastMessageID int `json:"last_message_id"`
+	// Turns is the number of user messages the summary covers.
+	Turns     int       `json:"turns"`
+	Model     string    `json:"model"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func GetSummary(chatID string) (*Summary, error) {
+	var s Summary
+	err := DB.QueryRow(`
+		SELECT chat_id, summary, last_message_id, turns, model, updated_at 
+		FROM chat_summaries 
+		WHERE chat_id = ?`, chatID).
+		Scan(&s.ChatID, &s.Summary, &s.LastMessageID, &s.Turns, &s.Model, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSummaryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// SaveSummary stores s in place of the previous summary of its chat.
+func SaveSummary(s *Summary) error {
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = time.Now().UTC()
+	}
+
+	_, err := DB.Exec(`
+		INSERT INTO chat_summaries (chat_id, summary, last_message_id, turns, model, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?) 
+		ON CONFLICT (chat_id) DO UPDATE SET 
+			summary = excluded.summary, 
+			last_message_id = excluded.last_message_id, 
+			turns = excluded.turns, 
+			model = excluded.model, 
+			updated_at = excluded.updated_at`,
+		s.ChatID, s.Summary, s.LastMessageID, s.Turns, s.Model, s.UpdatedAt)
+	return err
+}
@@ -0,0 +1,104 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+)
+
+// ID returns the ID of the PDF at path: the hex SHA-256 of its content, the
+// same as pdfExtractor indexes with every chunk.
+func ID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// skippedDirs hold the dependencies of the other parts of the repository
+// and are never searched for PDFs.
+var skippedDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Scan registers the PDFs under root and returns how many were hashed.
+// Files registered before with the same size and modification time are
+// not hashed again; a changed file replaces its earlier registration, so
+// the ID of the old content is no longer served. Hidden directories, such
+// as .git, and the ones in skippedDirs are not searched.
+func Scan(root string) (int, error) {
+	hashed := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("documents: accessing %s: %v", path, err)
+			return nil
+		}
+		if info.IsDir() && path != root && (strings.HasPrefix(info.Name(), ".") || skippedDirs[info.Name()]) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".pdf") {
+			return nil
+		}
+
+		known, err := db.GetDocumentByPath(path)
+		if err != nil && !errors.Is(err, db.ErrDocumentNotFound) {
+			return err
+		}
+		if known != nil && known.Size == info.Size() && known.ModifiedAt.Equal(info.ModTime().UTC()) {
+			return nil
+		}
+
+		sourceFile, err := filepath.Rel(root, path)
+		if err != nil {
+			sourceFile = path
+		}
+
+		id, err := ID(path)
+		if err != nil {
+			log.Printf("documents: hashing %s: %v", path, err)
+			return nil
+		}
+		hashed++
+
+		return db.RegisterDocument(&db.Document{
+			ID:         id,
+			Path:       path,
+			SourceFile: filepath.ToSlash(sourceFile),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UTC(),
+		})
+	})
+	if err != nil {
+		return hashed, fmt.Errorf("scanning documents in %s: %w", root, err)
+	}
+
+	return hashed, nil
+}
+
+// URL links to page of the document served by GET /documents/:id. PDF
+// viewers open the file at the #page fragment. baseURL may be empty for a
+// link relative to the backend.
+func URL(baseURL string, id string, page int) string {
+	link := strings.TrimSuffix(baseURL, "/") + "/documents/" + url.PathEscape(id)
+	if page > 0 {
+		link += fmt.Sprintf("#page=%d", page)
+	}
+	return link
+}
@@ -0,0 +1,72 @@
+package documents
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/db"
+)
+
+func TestScanChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := db.InitDB(filepath.Join(dir, "chat.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.CloseDB)
+
+	root := filepath.Join(dir, "docs")
+	path := filepath.Join(root, "Roofing", "membranes.pdf")
+	write := func(content string) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		id, err := ID(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	scan := func(wantHashed int) {
+		t.Helper()
+		hashed, err := Scan(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashed != wantHashed {
+			t.Errorf("Scan() hashed %d files, want %d", hashed, wantHashed)
+		}
+	}
+
+	oldID := write("%PDF-1.4 first edition")
+	scan(1)
+	scan(0)
+
+	newID := write("%PDF-1.4 second, longer edition")
+	scan(1)
+
+	if _, err := db.GetDocument(oldID); !errors.Is(err, db.ErrDocumentNotFound) {
+		t.Errorf("GetDocument(old ID) error = %v, want ErrDocumentNotFound", err)
+	}
+	d, err := db.GetDocumentByPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != newID || d.SourceFile != "Roofing/membranes.pdf" {
+		t.Errorf("document of the path = %s %s, want %s Roofing/membranes.pdf", d.ID, d.SourceFile, newID)
+	}
+	all, err := db.ListDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Errorf("%d documents registered, want 1", len(all))
+	}
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Request struct {
+	Messages    []Message
+	Temperature *float64
+	MaxTokens   int
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+}
+
+// ErrContextLengthExceeded is wrapped by provider errors for prompts longer
+// than the model context.
+var ErrContextLengthExceeded = errors.New("context length exceeded")
+
+// ChatCompleter is implemented by every LLM provider the backend can talk to.
+type ChatCompleter interface {
+	Complete(ctx context.Context, request Request) (*Response, error)
+}
+
+// Factory builds a ChatCompleter for the given model name.
+type Factory func(model string) (ChatCompleter, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a provider available under the given name. It is meant to be
+// called from the init function of the package implementing the provider.
+func Register(provider string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("llm: Register factory is nil")
+	}
+	if _, dup := factories[provider]; dup {
+		panic("llm: Register called twice for provider " + provider)
+	}
+	factories[provider] = factory
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns a ChatCompleter of a registered provider.
+func New(provider string, model string) (ChatCompleter, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[provider]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown llm provider %q (registered: %v)", provider, Providers())
+	}
+	return factory(model)
+}
+
+// StreamCompleter is implemented by providers able to return the answer
+// incrementally. onDelta is called for every chunk of generated text; an
+// error returned from it aborts the stream.
+type StreamCompleter interface {
+	ChatCompleter
+	Stream(ctx context.Context, request Request, onDelta func(delta string) error) (*Response, error)
+}
+
+// Stream streams the answer of completer when it supports streaming and
+// otherwise delivers the whole answer as a single delta.
+func Stream(ctx context.Context, completer ChatCompleter, request Request, onDelta func(delta string) error) (*Response, error) {
+	if streamer, ok := completer.(StreamCompleter); ok {
+		return streamer.Stream(ctx, request, onDelta)
+	}
+
+	resp, err := completer.Complete(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := onDelta(resp.Content); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
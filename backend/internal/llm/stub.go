@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// Stub answers without calling any external service. It is useful for running
+// the backend locally without API credentials.
+type Stub struct {
+	Model string
+}
+
+func init() {
+	Register("stub", func(model string) (ChatCompleter, error) {
+		return &Stub{Model: model}, nil
+	})
+}
+
+func (s *Stub) Complete(ctx context.Context, request Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	question := ""
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == RoleUser {
+			question = request.Messages[i].Content
+			break
+		}
+	}
+
+	content := "This is a stub answer to: " + firstLine(question)
+	return &Response{
+		Content: content,
+		Model:   s.Model,
+		Usage: Usage{
+			PromptTokens:     len(strings.Fields(question)),
+			CompletionTokens: len(strings.Fields(content)),
+			TotalTokens:      len(strings.Fields(question)) + len(strings.Fields(content)),
+		},
+	}, nil
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func (s *Stub) Stream(ctx context.Context, request Request, onDelta func(delta string) error) (*Response, error) {
+	resp, err := s.Complete(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, word := range strings.SplitAfter(resp.Content, " ") {
+		if i > 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"unicode"
+)
+
+// Tokenizer counts the tokens a model sees for a text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// Overhead of the chat format: every message is wrapped in a few tokens
+// and the answer is primed with a few more.
+const (
+	tokensPerMessage = 4
+	tokensPerReply   = 3
+)
+
+// ApproxTokenizer estimates BPE token counts without the model vocabulary.
+// Short words count as one token and long ones as one token per six
+// letters, digits go by three, every punctuation mark and every CJK
+// character is a token of its own. The estimate rather errs on the high
+// side, which is what budgeting needs.
+type ApproxTokenizer struct{}
+
+func (ApproxTokenizer) CountTokens(text string) int {
+	tokens := 0
+	letters, digits := 0, 0
+	flush := func() {
+		if letters > 0 {
+			tokens += 1 + (letters-1)/6
+			letters = 0
+		}
+		if digits > 0 {
+			tokens += 1 + (digits-1)/3
+			digits = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// CountMessageTokens counts the tokens of a chat request made of messages,
+// including the chat format overhead.
+func CountMessageTokens(tokenizer Tokenizer, messages []Message) int {
+	tokens := tokensPerReply
+	for _, m := range messages {
+		tokens += MessageTokens(tokenizer, m)
+	}
+	return tokens
+}
+
+// MessageTokens counts the tokens of a single message in a chat request.
+func MessageTokens(tokenizer Tokenizer, message Message) int {
+	return tokensPerMessage + tokenizer.CountTokens(message.Role) + tokenizer.CountTokens(message.Content)
+}
@@ -2,10 +2,21 @@ package pallm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os/exec"
+	"strings"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/lib/gauth"
+)
+
+const (
+	projectID    = "hackzurich23-8200"
+	defaultModel = "text-bison"
 )
 
 type RequestParameters struct {
@@ -55,17 +66,12 @@ type Response struct {
 	Metadata    Metadata     `json:"metadata"`
 }
 
-func GetAccessToken() (string, error) {
-	cmd := exec.Command("gcloud", "auth", "print-access-token")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(out[0 : len(out)-1]), nil
+func MakeRequest(prompt string, params RequestParameters) (Response, error) {
+	return MakeRequestWithContext(context.Background(), defaultModel, prompt, params)
 }
 
-func MakeRequest(prompt string, params RequestParameters) (Response, error) {
-	accessToken, err := GetAccessToken()
+func MakeRequestWithContext(ctx context.Context, model string, prompt string, params RequestParameters) (Response, error) {
+	accessToken, err := gauth.DefaultAccessToken(ctx)
 	if err != nil {
 		return Response{}, err
 	}
@@ -82,12 +88,14 @@ func MakeRequest(prompt string, params RequestParameters) (Response, error) {
 		return Response{}, err
 	}
 
-	req, err := http.NewRequest("POST", "https://us-central1-aiplatform.googleapis.com/v1/projects/hackzurich23-8200/locations/us-central1/publishers/google/models/text-bison:predict", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST",
+		fmt.Sprintf("https://us-central1-aiplatform.googleapis.com/v1/projects/%s/locations/us-central1/publishers/google/models/%s:predict", projectID, model),
+		bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return Response{}, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+string(accessToken))
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
@@ -102,8 +110,94 @@ func MakeRequest(prompt string, params RequestParameters) (Response, error) {
 		return Response{}, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
 	var parsed Response
 	err = json.Unmarshal(respBody, &parsed)
 
 	return parsed, err
 }
+
+var defaultParameters = RequestParameters{
+	Temperature:     0.2,
+	MaxOutputTokens: 1024,
+	TopK:            40,
+	TopP:            0.8,
+}
+
+// Client is the Vertex PaLM implementation of llm.ChatCompleter. text-bison
+// has no notion of roles, so the conversation is flattened into one prompt.
+type Client struct {
+	Model      string
+	Parameters RequestParameters
+}
+
+func init() {
+	llm.Register("palm", func(model string) (llm.ChatCompleter, error) {
+		return NewClient(model), nil
+	})
+}
+
+func NewClient(model string) *Client {
+	if model == "" {
+		model = defaultModel
+	}
+	return &Client{Model: model, Parameters: defaultParameters}
+}
+
+func (c *Client) Complete(ctx context.Context, request llm.Request) (*llm.Response, error) {
+	params := c.Parameters
+	if request.Temperature != nil {
+		params.Temperature = *request.Temperature
+	}
+	if request.MaxTokens > 0 {
+		params.MaxOutputTokens = request.MaxTokens
+	}
+
+	resp, err := MakeRequestWithContext(ctx, c.Model, flattenMessages(request.Messages), params)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Predictions) == 0 {
+		return nil, errors.New("empty predictions in response")
+	}
+	if resp.Predictions[0].SafetyAttributes.Blocked {
+		return nil, errors.New("response blocked by safety filters")
+	}
+
+	input := resp.Metadata.TokenMetadata.InputTokenCount.TotalTokens
+	output := resp.Metadata.TokenMetadata.OutputTokenCount.TotalTokens
+	return &llm.Response{
+		Content: strings.TrimSpace(resp.Predictions[0].Content),
+		Model:   c.Model,
+		Usage: llm.Usage{
+			PromptTokens:     input,
+			CompletionTokens: output,
+			TotalTokens:      input + output,
+		},
+	}, nil
+}
+
+func flattenMessages(messages []llm.Message) string {
+	if len(messages) == 1 {
+		return messages[0].Content
+	}
+
+	var sb strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case llm.RoleSystem:
+			sb.WriteString("Instructions: ")
+		case llm.RoleAssistant:
+			sb.WriteString("Assistant: ")
+		default:
+			sb.WriteString("User: ")
+		}
+		sb.WriteString(m.Content)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("Assistant:")
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package rerank
+
+import (
+	"context"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// Lexical is a local reranker without any model call. A document scores the
+// IDF-weighted share of the query terms it contains, with IDF computed over
+// the candidate set, so rare terms like product codes dominate. Query terms
+// found in no candidate tell the candidates apart no better and are ignored.
+type Lexical struct{}
+
+func NewLexical() *Lexical {
+	return &Lexical{}
+}
+
+func (l *Lexical) Rerank(ctx context.Context, query string, documents []templater.Document) ([]templater.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	queryTerms := uniqueTerms(query)
+	docTerms := make([]map[string]bool, len(documents))
+	df := make(map[string]int)
+	for i, d := range documents {
+		docTerms[i] = make(map[string]bool)
+		for _, t := range uniqueTerms(d.Content) {
+			docTerms[i][t] = true
+			df[t]++
+		}
+	}
+
+	idf := func(term string) float64 {
+		n := float64(len(documents))
+		return math.Log(1 + (n-float64(df[term])+0.5)/(float64(df[term])+0.5))
+	}
+
+	var total float64
+	for _, t := range queryTerms {
+		if df[t] > 0 {
+			total += idf(t)
+		}
+	}
+
+	scored := make([]templater.Document, len(documents))
+	for i, d := range documents {
+		var matched float64
+		for _, t := range queryTerms {
+			if docTerms[i][t] {
+				matched += idf(t)
+			}
+		}
+		d.Score = 0
+		if total > 0 {
+			d.Score = matched / total
+		}
+		scored[i] = d
+	}
+
+	return scored, nil
+}
+
+// uniqueTerms lowercases text and splits it into distinct terms of letters
+// and digits. Terms of one character are dropped.
+func uniqueTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len([]rune(f)) < 2 || seen[f] {
+			continue
+		}
+		seen[f] = true
+		terms = append(terms, f)
+	}
+	return terms
+}
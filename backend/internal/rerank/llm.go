@@ -0,0 +1,165 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// maxLLMScore is the top of the scale the rerank template asks for.
+const maxLLMScore = 10
+
+type relevance struct {
+	Document int     `json:"document"`
+	Score    float64 `json:"score"`
+}
+
+type relevanceOutput struct {
+	Scores []relevance `json:"scores"`
+}
+
+// LLM asks the model to grade the candidates using the rerank template.
+// The candidates are split into batches whose prompts fit the token budget
+// of the model, graded concurrently. Documents the model leaves out, and
+// documents too long for a prompt of their own, score 0.
+type LLM struct {
+	tmpl      *templater.Templater
+	completer llm.ChatCompleter
+	tokenizer llm.Tokenizer
+	budget    int
+}
+
+func NewLLM(tmpl *templater.Templater, completer llm.ChatCompleter, tokenizer llm.Tokenizer, budget int) *LLM {
+	return &LLM{
+		tmpl:      tmpl,
+		completer: completer,
+		tokenizer: tokenizer,
+		budget:    budget,
+	}
+}
+
+type batch struct {
+	start  int
+	count  int
+	prompt string
+}
+
+func (r *LLM) Rerank(ctx context.Context, query string, documents []templater.Document) ([]templater.Document, error) {
+	var batches []batch
+	for start := 0; start < len(documents); {
+		b, err := r.fit(query, documents[start:])
+		if err != nil {
+			return nil, err
+		}
+		if b.count == 0 {
+			log.Printf("rerank: document %s does not fit a prompt of %d tokens", documents[start].ID, r.budget)
+			start++
+			continue
+		}
+		b.start = start
+		batches = append(batches, b)
+		start += b.count
+	}
+
+	scores := make([]float64, len(documents))
+	errs := make(chan error, len(batches))
+	wg := &sync.WaitGroup{}
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b batch) {
+			defer wg.Done()
+			batchScores, err := r.grade(ctx, b)
+			if err != nil {
+				errs <- err
+				return
+			}
+			copy(scores[b.start:], batchScores)
+		}(b)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	scored := make([]templater.Document, len(documents))
+	for i, d := range documents {
+		d.Score = scores[i]
+		scored[i] = d
+	}
+
+	return scored, nil
+}
+
+// fit returns the prompt grading the most leading documents that fits the
+// budget. Its count is 0 when not even the first document fits.
+func (r *LLM) fit(query string, documents []templater.Document) (batch, error) {
+	var fitted batch
+	for n := 1; n <= len(documents); n++ {
+		prompt, err := r.tmpl.ProcessTemplateRerank(query, documents[:n])
+		if err != nil {
+			return batch{}, err
+		}
+		if llm.MessageTokens(r.tokenizer, llm.Message{Role: llm.RoleUser, Content: prompt}) > r.budget {
+			break
+		}
+		fitted = batch{count: n, prompt: prompt}
+	}
+	return fitted, nil
+}
+
+func (r *LLM) grade(ctx context.Context, b batch) ([]float64, error) {
+	temperature := 0.0
+	resp, err := r.completer.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: b.prompt,
+			},
+		},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScores(resp.Content, b.count)
+}
+
+// parseScores maps the 1-based document numbers of the model output to
+// scores in [0, 1].
+func parseScores(content string, count int) ([]float64, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in rerank output %q", content)
+	}
+
+	var output relevanceOutput
+	if err := json.Unmarshal([]byte(content[start:end+1]), &output); err != nil {
+		return nil, fmt.Errorf("parsing rerank output: %w", err)
+	}
+
+	scores := make([]float64, count)
+	for _, r := range output.Scores {
+		if r.Document < 1 || r.Document > count {
+			return nil, fmt.Errorf("rerank output refers to unknown document %d", r.Document)
+		}
+		score := r.Score / maxLLMScore
+		if score < 0 {
+			score = 0
+		}
+		if score > 1 {
+			score = 1
+		}
+		scores[r.Document-1] = score
+	}
+
+	return scores, nil
+}
@@ -0,0 +1,78 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+type words struct{}
+
+func (words) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+var numbered = regexp.MustCompile(`\[(\d+)\] (\w+)`)
+
+// grader scores the documents of a prompt starting with "good" 10 and
+// counts the prompts it sees.
+type grader struct {
+	mu      sync.Mutex
+	prompts int
+}
+
+func (g *grader) Complete(ctx context.Context, request llm.Request) (*llm.Response, error) {
+	g.mu.Lock()
+	g.prompts++
+	g.mu.Unlock()
+
+	var scores []string
+	for _, m := range numbered.FindAllStringSubmatch(request.Messages[0].Content, -1) {
+		score := 0
+		if m[2] == "good" {
+			score = 10
+		}
+		scores = append(scores, fmt.Sprintf(`{"document": %s, "score": %d}`, m[1], score))
+	}
+	return &llm.Response{Content: `{"scores": [` + strings.Join(scores, ", ") + `]}`}, nil
+}
+
+func TestLLMRerankBatches(t *testing.T) {
+	tmpl := &templater.Templater{
+		Rerank: "Q {{.Question}}{{range .Documents}} [{{.Number}}] {{.Content}}{{end}}",
+	}
+	documents := []templater.Document{
+		{ID: "a", Content: "good a b"},
+		{ID: "b", Content: "bad a b"},
+		{ID: "c", Content: "bad a b"},
+		{ID: "d", Content: "good a b"},
+		{ID: "long", Content: "good " + strings.Repeat("w ", 10)},
+		{ID: "e", Content: "good a b"},
+	}
+
+	// The message overhead is 5 tokens, the question 2 and every document
+	// 4, so that two documents fit a prompt.
+	g := &grader{}
+	scored, err := NewLLM(tmpl, g, words{}, 5+2+8).Rerank(context.Background(), "question", documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []float64
+	for _, d := range scored {
+		got = append(got, d.Score)
+	}
+	if want := []float64{1, 0, 0, 1, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scores = %v, want %v", got, want)
+	}
+	if g.prompts != 3 {
+		t.Errorf("%d prompts, want 3", g.prompts)
+	}
+}
@@ -0,0 +1,44 @@
+package rerank
+
+import (
+	"context"
+	"sort"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/templater"
+)
+
+// Reranker scores retrieved documents by their relevance to the query.
+// Scores are in [0, 1] so that one cutoff works for every implementation.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []templater.Document) ([]templater.Document, error)
+}
+
+// Select reranks the candidates and keeps the best topN scoring at least
+// minScore. It returns no documents when none is relevant enough.
+func Select(ctx context.Context, reranker Reranker, query string, candidates []templater.Document, topN int, minScore float64) ([]templater.Document, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	scored, err := reranker.Rerank(ctx, query, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	selected := make([]templater.Document, 0, topN)
+	for _, d := range scored {
+		if len(selected) == topN {
+			break
+		}
+		if d.Score < minScore {
+			break
+		}
+		selected = append(selected, d)
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,72 @@
+package retrieval
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/lib/vectorstore"
+)
+
+// Names of the metadata fields indexed by pdfExtractor.
+const (
+	FieldSourceFile      = vectorstore.FieldSourceFile
+	FieldLanguage        = vectorstore.FieldLanguage
+	FieldProductCategory = vectorstore.FieldProductCategory
+	FieldDocumentType    = vectorstore.FieldDocumentType
+	FieldDocumentDate    = vectorstore.FieldDocumentDate
+)
+
+const dateLayout = "2006-01-02"
+
+// Filter narrows retrieval to documents with matching metadata. Empty
+// fields do not filter; values inside one field are alternatives.
+type Filter struct {
+	SourceFiles       []string `json:"source_files,omitempty"`
+	Languages         []string `json:"languages,omitempty"`
+	ProductCategories []string `json:"product_categories,omitempty"`
+	DocumentTypes     []string `json:"document_types,omitempty"`
+	// DateFrom and DateTo bound the document date, as YYYY-MM-DD, inclusive.
+	DateFrom string `json:"date_from,omitempty"`
+	DateTo   string `json:"date_to,omitempty"`
+}
+
+func (f Filter) Validate() error {
+	for _, d := range []string{f.DateFrom, f.DateTo} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("bad date %q, expected YYYY-MM-DD", d)
+		}
+	}
+	if f.DateFrom != "" && f.DateTo != "" && f.DateFrom > f.DateTo {
+		return fmt.Errorf("date_from %s is after date_to %s", f.DateFrom, f.DateTo)
+	}
+	return nil
+}
+
+// StoreFilter translates the filter for the document store.
+func (f Filter) StoreFilter() vectorstore.Filter {
+	var filter vectorstore.Filter
+	terms := func(field string, values []string) {
+		if len(values) > 0 {
+			if filter.Terms == nil {
+				filter.Terms = make(map[string][]string)
+			}
+			filter.Terms[field] = values
+		}
+	}
+
+	terms(FieldSourceFile, f.SourceFiles)
+	terms(FieldLanguage, f.Languages)
+	terms(FieldProductCategory, f.ProductCategories)
+	terms(FieldDocumentType, f.DocumentTypes)
+
+	if f.DateFrom != "" || f.DateTo != "" {
+		filter.Ranges = map[string]vectorstore.Range{
+			FieldDocumentDate: {GTE: f.DateFrom, LTE: f.DateTo},
+		}
+	}
+
+	return filter
+}
@@ -16,8 +16,34 @@ type InitQuestionData struct {
 }
 
 type Document struct {
-	Url     string
-	Offset  int
+	ID     string
+	Url    string
+	Offset int
+	// Page is the 1-based page of the source PDF, 0 when unknown.
+	Page    int
+	Content string
+	// Score is the relevance given by retrieval or by the reranker.
+	Score float64
+}
+
+// NumberedDocument is a document with its 1-based position in a prompt.
+type NumberedDocument struct {
+	Number int
+	Document
+}
+
+// NumberDocuments numbers documents in the order they are given.
+func NumberDocuments(documents []Document) []NumberedDocument {
+	numbered := make([]NumberedDocument, 0, len(documents))
+	for i, d := range documents {
+		numbered = append(numbered, NumberedDocument{Number: i + 1, Document: d})
+	}
+	return numbered
+}
+
+// HistoryMessage is a message of the conversation shown in a prompt.
+type HistoryMessage struct {
+	Role    string
 	Content string
 }
 
@@ -25,11 +51,25 @@ type Corner struct {
 	Name     string `yaml:"name"`
 	Question string `yaml:"question"`
 	Answer   string `yaml:"answer"`
+	// Description is what the multi-label classifier is told about the corner.
+	Description string `yaml:"description"`
+	// Threshold is the minimal classifier confidence for a match. Zero means
+	// the configured default.
+	Threshold float64 `yaml:"threshold"`
+	// Examples are utterances matched against the question by embedding
+	// similarity, with Similarity as the minimal cosine similarity.
+	Examples   []string `yaml:"examples"`
+	Similarity float64  `yaml:"similarity"`
 }
 
 type Templater struct {
 	InitQuestion string    `yaml:"initQuestion"`
 	AllQuestions string    `yaml:"allQuestions"`
+	NoAnswer     string    `yaml:"noAnswer"`
+	Classifier   string    `yaml:"classifier"`
+	Rerank       string    `yaml:"rerank"`
+	Condense     string    `yaml:"condense"`
+	Summary      string    `yaml:"summary"`
 	Corners      []*Corner `yaml:"corners"`
 }
 
@@ -58,7 +98,15 @@ func (t *Templater) ProcessTemplateInitQuestionData(data []InitQuestionData) (st
 
 	var output bytes.Buffer
 	for _, d := range data {
-		err = tmpl.Execute(&output, d)
+		err = tmpl.Execute(&output, struct {
+			Language  string
+			Question  string
+			Documents []NumberedDocument
+		}{
+			Language:  d.Language,
+			Question:  d.Question,
+			Documents: NumberDocuments(d.Documents),
+		})
 		if err != nil {
 			return "", err
 		}
@@ -67,8 +115,10 @@ func (t *Templater) ProcessTemplateInitQuestionData(data []InitQuestionData) (st
 	return output.String(), nil
 }
 
+// ProcessTemplateAllQuestionsData renders a follow-up question. summary is
+// the running summary of the chat and may be empty.
 func (t *Templater) ProcessTemplateAllQuestionsData(question string,
-	language string, documents []Document) (string, error) {
+	language string, summary string, documents []Document) (string, error) {
 	tmpl, err := template.New("questionTemplate").Parse(t.AllQuestions)
 	if err != nil {
 		return "", err
@@ -77,11 +127,13 @@ func (t *Templater) ProcessTemplateAllQuestionsData(question string,
 	data := struct {
 		Question  string
 		Language  string
-		Documents []Document
+		Summary   string
+		Documents []NumberedDocument
 	}{
 		Question:  question,
 		Language:  language,
-		Documents: documents,
+		Summary:   summary,
+		Documents: NumberDocuments(documents),
 	}
 
 	var output bytes.Buffer
@@ -143,3 +195,134 @@ func (t *Templater) GetCornerResponse(cornerName string) (string, error) {
 
 	return "", fmt.Errorf("corner not found")
 }
+
+func (t *Templater) GetCorner(cornerName string) (*Corner, error) {
+	for _, c := range t.Corners {
+		if c.Name == cornerName {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("corner not found")
+}
+
+func (t *Templater) ProcessTemplateClassifier(question string) (string, error) {
+	tmpl, err := template.New("classifierTemplate").Parse(t.Classifier)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Question string
+		Corners  []*Corner
+	}{
+		Question: question,
+		Corners:  t.Corners,
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+func (t *Templater) ProcessTemplateRerank(question string, documents []Document) (string, error) {
+	tmpl, err := template.New("rerankTemplate").Parse(t.Rerank)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Question  string
+		Documents []NumberedDocument
+	}{
+		Question:  question,
+		Documents: NumberDocuments(documents),
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+// ProcessTemplateNoAnswer renders the prompt used when no document is
+// relevant enough to answer from.
+func (t *Templater) ProcessTemplateNoAnswer(question string, language string) (string, error) {
+	tmpl, err := template.New("noAnswerTemplate").Parse(t.NoAnswer)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Question string
+		Language string
+	}{
+		Question: question,
+		Language: language,
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+// ProcessTemplateCondense renders the prompt rewriting a follow-up question
+// into a standalone one.
+func (t *Templater) ProcessTemplateCondense(history []HistoryMessage, question string) (string, error) {
+	tmpl, err := template.New("condenseTemplate").Parse(t.Condense)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		History  []HistoryMessage
+		Question string
+	}{
+		History:  history,
+		Question: question,
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+// ProcessTemplateSummary renders the prompt folding history into the
+// previous summary of a chat, which may be empty.
+func (t *Templater) ProcessTemplateSummary(summary string, history []HistoryMessage) (string, error) {
+	tmpl, err := template.New("summaryTemplate").Parse(t.Summary)
+	if err != nil {
+		return "", err
+	}
+
+	data := struct {
+		Summary string
+		History []HistoryMessage
+	}{
+		Summary: summary,
+		History: history,
+	}
+
+	var output bytes.Buffer
+	err = tmpl.Execute(&output, data)
+	if err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
@@ -0,0 +1,75 @@
+package window
+
+import (
+	"fmt"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+// Input is a chat request split into the parts Fit treats differently.
+type Input struct {
+	// System messages go first and are always kept.
+	System []llm.Message
+	// History is the conversation so far, oldest first. The oldest turns are
+	// dropped when the request does not fit.
+	History []llm.Message
+	// Prompt is the final user message with the retrieved documents. It is
+	// always kept.
+	Prompt llm.Message
+}
+
+// Result is the request fitted into the budget.
+type Result struct {
+	Messages []llm.Message
+	Tokens   int
+	// Dropped is the number of history messages left out.
+	Dropped int
+}
+
+// BudgetError is returned when the messages that must be kept do not fit
+// into the budget on their own.
+type BudgetError struct {
+	Budget   int
+	Required int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("prompt needs %d tokens, budget is %d", e.Required, e.Budget)
+}
+
+// Fit builds the request from in using at most budget tokens. It keeps the
+// system messages and the prompt and as many of the latest history messages
+// as fit. History always restarts at a user message so that the model never
+// sees an answer without its question.
+func Fit(tokenizer llm.Tokenizer, budget int, in Input) (*Result, error) {
+	required := llm.CountMessageTokens(tokenizer, in.System) + llm.MessageTokens(tokenizer, in.Prompt)
+	if required > budget {
+		return nil, &BudgetError{Budget: budget, Required: required}
+	}
+
+	tokens := required
+	start := len(in.History)
+	for start > 0 {
+		t := llm.MessageTokens(tokenizer, in.History[start-1])
+		if tokens+t > budget {
+			break
+		}
+		tokens += t
+		start--
+	}
+	for start < len(in.History) && in.History[start].Role != llm.RoleUser {
+		tokens -= llm.MessageTokens(tokenizer, in.History[start])
+		start++
+	}
+
+	messages := make([]llm.Message, 0, len(in.System)+len(in.History)-start+1)
+	messages = append(messages, in.System...)
+	messages = append(messages, in.History[start:]...)
+	messages = append(messages, in.Prompt)
+
+	return &Result{
+		Messages: messages,
+		Tokens:   tokens,
+		Dropped:  start,
+	}, nil
+}
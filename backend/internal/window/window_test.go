@@ -0,0 +1,116 @@
+package window
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siriusfreak/hack-zurich-2023/backend/internal/llm"
+)
+
+// words counts a token per word, so that a message of n words measures
+// n + 5 tokens: 4 of chat format overhead and 1 for the role.
+type words struct{}
+
+func (words) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func msg(role string, n int) llm.Message {
+	return llm.Message{Role: role, Content: strings.TrimSpace(strings.Repeat("w ", n))}
+}
+
+func TestFit(t *testing.T) {
+	system := []llm.Message{msg(llm.RoleSystem, 5)}
+	prompt := msg(llm.RoleUser, 10)
+	history := []llm.Message{
+		msg(llm.RoleUser, 5),
+		msg(llm.RoleAssistant, 15),
+		msg(llm.RoleUser, 5),
+		msg(llm.RoleAssistant, 5),
+	}
+	// The system message and the prompt need 3 + 10 + 15 tokens.
+	const required = 28
+
+	tests := []struct {
+		name        string
+		budget      int
+		history     []llm.Message
+		wantHistory []llm.Message
+		wantTokens  int
+		wantErr     bool
+	}{
+		{
+			name:        "everything fits",
+			budget:      1000,
+			history:     history,
+			wantHistory: history,
+			wantTokens:  required + 10 + 20 + 10 + 10,
+		},
+		{
+			name:        "oldest turn dropped",
+			budget:      required + 20,
+			history:     history,
+			wantHistory: history[2:],
+			wantTokens:  required + 20,
+		},
+		{
+			name:        "answer without its question dropped",
+			budget:      required + 40,
+			history:     history,
+			wantHistory: history[2:],
+			wantTokens:  required + 20,
+		},
+		{
+			name:        "no room for history",
+			budget:      required + 5,
+			history:     history,
+			wantHistory: nil,
+			wantTokens:  required,
+		},
+		{
+			name:        "exact budget",
+			budget:      required,
+			history:     nil,
+			wantHistory: nil,
+			wantTokens:  required,
+		},
+		{
+			name:    "prompt too large",
+			budget:  required - 1,
+			history: history,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Fit(words{}, tt.budget, Input{System: system, History: tt.history, Prompt: prompt})
+			if tt.wantErr {
+				var budgetErr *BudgetError
+				if !errors.As(err, &budgetErr) || budgetErr.Required != required {
+					t.Fatalf("Fit() error = %v, want a BudgetError requiring %d", err, required)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := append(append(append([]llm.Message{}, system...), tt.wantHistory...), prompt)
+			if !reflect.DeepEqual(got.Messages, want) {
+				t.Errorf("Messages = %v, want %v", got.Messages, want)
+			}
+			if got.Tokens != tt.wantTokens {
+				t.Errorf("Tokens = %d, want %d", got.Tokens, tt.wantTokens)
+			}
+			if got.Dropped != len(tt.history)-len(tt.wantHistory) {
+				t.Errorf("Dropped = %d, want %d", got.Dropped, len(tt.history)-len(tt.wantHistory))
+			}
+			if got.Tokens > tt.budget {
+				t.Errorf("Tokens = %d over the budget of %d", got.Tokens, tt.budget)
+			}
+		})
+	}
+}
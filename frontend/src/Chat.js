@@ -16,6 +16,95 @@ const getAPIAddress = () => {
   }
 }
 
+// linkCitations turns the [n] markers of an answer into links to the cited
+// documents.
+const linkCitations = (text, citations) => {
+  if (!citations || citations.length === 0) {
+    return text;
+  }
+  const byNumber = new Map(citations.map((c) => [c.number, c]));
+  return text.replace(/\[(\d+(?:\s*,\s*\d+)*)\]/g, (marker, numbers) =>
+    numbers.split(',').map((n) => {
+      const citation = byNumber.get(parseInt(n, 10));
+      if (!citation || !citation.url) {
+        return `[${n.trim()}]`;
+      }
+      // Documents served by the backend are linked relative to it.
+      const url = citation.url.startsWith('/') ? getAPIAddress() + citation.url : citation.url;
+      return `[[${n.trim()}]](${url})`;
+    }).join(''));
+};
+
+// createChat asks the backend to allocate a new chat.
+const createChat = async (title) => {
+  const response = await fetch(`${getAPIAddress()}/chat`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      'Authorization': process.env['REACT_APP_AUTH_TOKEN']
+    },
+    body: JSON.stringify({ title }),
+  });
+  if (!response.ok) {
+    throw new Error("Network response was not ok " + response.statusText);
+  }
+  const data = await response.json();
+  return data.chat;
+};
+
+// streamChatMessage posts a message to the streaming endpoint and calls
+// onDelta for every chunk of the answer and onDone with the final event.
+const streamChatMessage = async (chatId, body, { onDelta, onDone }) => {
+  const response = await fetch(`${getAPIAddress()}/chat/${chatId}/stream`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+      'Accept': 'text/event-stream',
+      'Authorization': process.env['REACT_APP_AUTH_TOKEN']
+    },
+    body: JSON.stringify(body),
+  });
+  if (!response.ok) {
+    throw new Error("Network response was not ok " + response.statusText);
+  }
+
+  const reader = response.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) {
+      break;
+    }
+    buffer += decoder.decode(value, { stream: true });
+
+    let boundary;
+    while ((boundary = buffer.indexOf('\n\n')) >= 0) {
+      const raw = buffer.slice(0, boundary);
+      buffer = buffer.slice(boundary + 2);
+
+      let event = 'message';
+      let data = '';
+      raw.split('\n').forEach((line) => {
+        if (line.startsWith('event:')) {
+          event = line.slice(6).trim();
+        } else if (line.startsWith('data:')) {
+          data += line.slice(5);
+        }
+      });
+
+      const payload = JSON.parse(data);
+      if (event === 'delta') {
+        onDelta(payload.content);
+      } else if (event === 'done') {
+        onDone(payload);
+      } else if (event === 'error') {
+        throw new Error(payload.status);
+      }
+    }
+  }
+};
+
 const styles = {
   chatContainer: {
     padding: '50px',
@@ -174,47 +263,49 @@ function Chat() {
   });
   const [activeChatId, setActiveChatId] = useState(null);
 
-  const handleSend = () => {
+  const handleSend = async () => {
     if (inputValue.trim()) {
       const trimmedInput = inputValue.trim();
   
       let currentChatId = activeChatId;
   
       if (activeChatId === null) {
-        const newChatId = Math.floor(Math.random() * 1000000);
         const newChatName = trimmedInput.length > 15 ? `${trimmedInput.substring(0, 15)}...` : trimmedInput;
-        const newChat = { id: newChatId, name: newChatName };
-  
+        let newChat;
+        try {
+          newChat = await createChat(newChatName);
+        } catch (error) {
+          console.error('Error creating chat:', error);
+          return;
+        }
+
         setChatList((prevChatList) => {
-          const updatedChatList = [...prevChatList, newChat];
+          const updatedChatList = [newChat, ...prevChatList];
           localStorage.setItem('chatList', JSON.stringify(updatedChatList));
           return updatedChatList;
         });
         
-        setActiveChatId(newChatId);
-        currentChatId = newChatId;
+        setActiveChatId(newChat.chat_id);
+        currentChatId = newChat.chat_id;
       }
 
       const newMessage = { text: trimmedInput, sender: currentUser };
       setMessages((prevMessages) => [...prevMessages, newMessage]);
       setInputValue('');
   
-      fetch(`${getAPIAddress()}/chat/${currentChatId}`, {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': process.env['REACT_APP_AUTH_TOKEN']
-        },
-        body: JSON.stringify({ message: trimmedInput, language: selectedLanguage }),
-      })
-        .then((response) => response.json())
-        .then((data) => {
-          setMessages((prevMessages) => [
-            ...prevMessages,
-            { text: data.response, sender: currentUser === 'You' ? 'Assistant' : 'You' },
-          ]);
-        })
-        .catch((error) => console.error('Error:', error));
+      const assistant = currentUser === 'You' ? 'Assistant' : 'You';
+      setMessages((prevMessages) => [...prevMessages, { text: '', sender: assistant }]);
+      const updateAnswer = (update, citations) => {
+        setMessages((prevMessages) => {
+          const last = prevMessages[prevMessages.length - 1];
+          return [...prevMessages.slice(0, -1), { ...last, text: update(last.text), citations }];
+        });
+      };
+
+      streamChatMessage(currentChatId, { message: trimmedInput, language: selectedLanguage }, {
+        onDelta: (delta) => updateAnswer((text) => text + delta),
+        onDone: (data) => updateAnswer(() => data.response, data.citations),
+      }).catch((error) => console.error('Error:', error));
   
       //setCurrentUser((prevUser) => (prevUser === 'You' ? 'Assistant' : 'You'));
     }
@@ -257,6 +348,7 @@ function Chat() {
       .then((data) => {
         setMessages(data.map(msg => ({
           text: msg.message,
+          citations: msg.citations,
           sender: msg.is_bot ? 'Assistant' : 'You',
         })));
       })
@@ -319,7 +411,7 @@ function Chat() {
                     // setMessages([]);
                 }}
                 sx={activeChatId === chat.chat_id ? styles.activeChatItem : styles.unactiveChatItem}>
-                    <ListItemText primary={chat.name} />
+                    <ListItemText primary={chat.title} />
                     <Divider />
                 </ListItem>
             ))}
@@ -378,7 +470,7 @@ function Chat() {
                   secondary={
                     <span
                         dangerouslySetInnerHTML={{
-                          __html: marked(message.text),
+                          __html: marked(linkCitations(message.text, message.citations)),
                         }}
                     />
                   }
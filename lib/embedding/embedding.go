@@ -0,0 +1,350 @@
+// Package embedding embeds texts with Vertex AI. The chat backend embeds
+// questions and pdfExtractor embeds document chunks with it, so that both
+// come from the same model.
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/lib/gauth"
+)
+
+// Embedder returns the embeddings of texts, in order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	// Model identifies the embeddings: vectors of different models must not
+	// be compared.
+	Model() string
+	// Dimension is the length of the vectors, or 0 when the model does not
+	// declare it.
+	Dimension() int
+}
+
+// Providers selectable in Config.
+const (
+	ProviderVertex  = "vertex"
+	ProviderHashing = "hashing"
+)
+
+// New returns the embedder of the provider in cfg, Vertex by default.
+func New(cfg Config) (Embedder, error) {
+	switch cfg.Provider {
+	case ProviderVertex, "":
+		return NewVertex(cfg)
+	case ProviderHashing:
+		return NewHashing(cfg.Dimension)
+	default:
+		return nil, fmt.Errorf("embedding: unknown provider %q (known: %s, %s)", cfg.Provider, ProviderVertex, ProviderHashing)
+	}
+}
+
+// Defaults of Config.
+const (
+	DefaultRegion       = "us-central1"
+	DefaultModel        = "multimodalembedding@001"
+	DefaultMaxInstances = 32
+	DefaultRetries      = 3
+	DefaultBackoff      = time.Second
+)
+
+// Limiter delays requests to stay within a quota.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// maxInstances are the numbers of texts the known Vertex AI models accept
+// per request. Other models start at DefaultMaxInstances. DefaultModel takes
+// one text only, so embedding with it costs a request per text.
+var maxInstances = map[string]int{
+	"multimodalembedding@001": 1,
+	"textembedding-gecko@001": 5,
+	"textembedding-gecko@002": 5,
+	"textembedding-gecko@003": 5,
+}
+
+// MaxInstances returns the number of texts the model accepts per request.
+func MaxInstances(model string) int {
+	if n, ok := maxInstances[model]; ok {
+		return n
+	}
+	return DefaultMaxInstances
+}
+
+// dimensions are the vector lengths of the known Vertex AI models.
+var dimensions = map[string]int{
+	"multimodalembedding@001": 1408,
+	"textembedding-gecko@001": 768,
+	"textembedding-gecko@002": 768,
+	"textembedding-gecko@003": 768,
+}
+
+// Config configures an embedder. Zero values pick the defaults.
+type Config struct {
+	// Provider is ProviderVertex or ProviderHashing.
+	Provider string
+	// Dimension declares the length of the vectors. Vertex embeddings of
+	// another length are rejected; it defaults to the known length of the
+	// model.
+	Dimension int
+
+	// The remaining fields configure Vertex.
+	ProjectID string
+	Region    string
+	Model     string
+	// Endpoint is the base URL of the prediction API, by default the one of
+	// the region.
+	Endpoint string
+	// MaxInstances is the number of texts sent per request, by default the
+	// limit of the model, see MaxInstances.
+	MaxInstances int
+	// Retries is how often a request failing temporarily is retried, with
+	// exponential backoff starting at Backoff. Zero disables retries, unlike
+	// the other fields it has no default; DefaultRetries suits most callers.
+	Retries int
+	Backoff time.Duration
+	// Limiter, when set, is waited for before every request.
+	Limiter Limiter
+	// Token returns the OAuth access token of the requests, by default
+	// gauth.DefaultAccessToken.
+	Token      func(ctx context.Context) (string, error)
+	HTTPClient *http.Client
+}
+
+// Vertex embeds texts with a Vertex AI embedding model. It sends up to
+// MaxInstances texts per request and maps the predictions back to their
+// texts by position.
+//
+// A batch rejected for holding too many texts is split in half and each
+// half retried, and the limit is lowered for the following batches. A
+// single text rejected as invalid only fails itself; other rejected
+// batches fail as a whole.
+type Vertex struct {
+	cfg Config
+	url string
+
+	mu    sync.Mutex
+	limit int
+}
+
+// NewVertex returns a Vertex embedder.
+func NewVertex(cfg Config) (*Vertex, error) {
+	if cfg.ProjectID == "" {
+		return nil, fmt.Errorf("embedding: no project ID")
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://%s-aiplatform.googleapis.com", cfg.Region)
+	}
+	if cfg.MaxInstances < 1 {
+		cfg.MaxInstances = MaxInstances(cfg.Model)
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = DefaultBackoff
+	}
+	if cfg.Token == nil {
+		cfg.Token = gauth.DefaultAccessToken
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Dimension == 0 {
+		cfg.Dimension = dimensions[cfg.Model]
+	}
+
+	return &Vertex{
+		cfg: cfg,
+		url: fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/google/models/%s:predict",
+			strings.TrimSuffix(cfg.Endpoint, "/"), cfg.ProjectID, cfg.Region, cfg.Model),
+		limit: cfg.MaxInstances,
+	}, nil
+}
+
+// Model returns the name of the Vertex AI model.
+func (v *Vertex) Model() string {
+	return v.cfg.Model
+}
+
+func (v *Vertex) Dimension() int {
+	return v.cfg.Dimension
+}
+
+// MaxInstances returns the current number of texts per request.
+func (v *Vertex) MaxInstances() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.limit
+}
+
+func (v *Vertex) lower(limit int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if limit < v.limit {
+		v.limit = limit
+	}
+}
+
+// Embed returns the embeddings of texts, in order. When some texts fail,
+// the others are still embedded and the error is an InstanceErrors with nil
+// embeddings at the failed indexes. Other errors abort the whole call.
+func (v *Vertex) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	failed := make(InstanceErrors)
+
+	for start := 0; start < len(texts); {
+		end := start + v.MaxInstances()
+		if end > len(texts) {
+			end = len(texts)
+		}
+		if err := v.embedBatch(ctx, texts, start, end, embeddings, failed); err != nil {
+			return nil, err
+		}
+		start = end
+	}
+
+	if len(failed) > 0 {
+		return embeddings, failed
+	}
+	return embeddings, nil
+}
+
+// embedBatch embeds texts[start:end] with one request, splitting it when it
+// holds too many texts.
+func (v *Vertex) embedBatch(ctx context.Context, texts []string, start, end int, embeddings [][]float64, failed InstanceErrors) error {
+	request := PredictRequest{Instances: make([]Instance, 0, end-start)}
+	for _, text := range texts[start:end] {
+		request.Instances = append(request.Instances, Instance{Text: text})
+	}
+
+	response, err := v.Predict(ctx, request)
+	if err == nil && len(response.Predictions) != end-start {
+		err = fmt.Errorf("%w: %d predictions for %d instances", ErrPredictionCount, len(response.Predictions), end-start)
+	}
+	if err != nil {
+		if !rejected(err) {
+			return err
+		}
+		if end-start == 1 {
+			failed[start] = err
+			return nil
+		}
+		if !tooManyInstances(err) {
+			return err
+		}
+
+		middle := start + (end-start)/2
+		v.lower(end - middle)
+		if err := v.embedBatch(ctx, texts, start, middle, embeddings, failed); err != nil {
+			return err
+		}
+		return v.embedBatch(ctx, texts, middle, end, embeddings, failed)
+	}
+
+	for i, prediction := range response.Predictions {
+		if v.cfg.Dimension > 0 && len(prediction.TextEmbedding) != v.cfg.Dimension {
+			return fmt.Errorf("%w: %s returned %d values, declared %d",
+				ErrDimension, v.cfg.Model, len(prediction.TextEmbedding), v.cfg.Dimension)
+		}
+		embeddings[start+i] = prediction.TextEmbedding
+	}
+	return nil
+}
+
+type PredictRequest struct {
+	Instances []Instance `json:"instances"`
+}
+
+type Instance struct {
+	Text string `json:"text"`
+}
+
+type PredictResponse struct {
+	Predictions     []Prediction `json:"predictions"`
+	DeployedModelID string       `json:"deployedModelId"`
+}
+
+type Prediction struct {
+	TextEmbedding []float64 `json:"textEmbedding"`
+}
+
+// Predict sends a prediction request, retrying temporary failures.
+func (v *Vertex) Predict(ctx context.Context, request PredictRequest) (*PredictResponse, error) {
+	delay := v.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		response, err := v.predict(ctx, request)
+		if err == nil || attempt >= v.cfg.Retries || !temporary(err) {
+			return response, err
+		}
+
+		// Jitter keeps concurrent callers hitting a quota together from
+		// retrying together.
+		timer := time.NewTimer(delay/2 + time.Duration(rand.Int63n(int64(delay)+1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (v *Vertex) predict(ctx context.Context, request PredictRequest) (*PredictResponse, error) {
+	if v.cfg.Limiter != nil {
+		if err := v.cfg.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken, err := v.cfg.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("embedding: access token: %w", err)
+	}
+
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var response PredictResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrPredictionCount is returned when the service answers with another
+// number of predictions than texts sent.
+var ErrPredictionCount = errors.New("embedding: prediction count mismatch")
+
+// ErrDimension is returned when an embedding does not have the declared
+// dimension.
+var ErrDimension = errors.New("embedding: dimension mismatch")
+
+// StatusError is a non-200 answer of the prediction endpoint.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("embedding: status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary tells whether retrying the request may succeed: the quota was
+// exceeded or the service failed.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// InstanceErrors reports the texts that could not be embedded, by index.
+type InstanceErrors map[int]error
+
+func (e InstanceErrors) Error() string {
+	indexes := make([]int, 0, len(e))
+	for i := range e {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	messages := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		messages = append(messages, fmt.Sprintf("text %d: %v", i, e[i]))
+	}
+	return fmt.Sprintf("embedding: %d of the texts not embedded: %s", len(e), strings.Join(messages, "; "))
+}
+
+// temporary tells whether a request failing with err may succeed when
+// retried.
+func temporary(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// rejected tells whether the service refused the request itself rather
+// than failing to serve it.
+func rejected(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusBadRequest
+	}
+	return false
+}
+
+// tooManyInstances tells whether a rejected request held more texts than
+// the model accepts. Vertex AI only says so in the message of the error,
+// which names the instances and the limit they exceed.
+func tooManyInstances(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(status.Body)
+	if !strings.Contains(body, "instance") {
+		return false
+	}
+	for _, word := range []string{"exceed", "maximum", "too many", "limit"} {
+		if strings.Contains(body, word) {
+			return true
+		}
+	}
+	return false
+}
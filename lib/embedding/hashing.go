@@ -0,0 +1,100 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultHashingDimension is the dimension of Hashing embeddings when the
+// config does not declare one.
+const DefaultHashingDimension = 512
+
+// Hashing embeds texts locally with the hashing trick: words, word bigrams
+// and character trigrams are hashed into a vector of Dimension buckets with
+// a hash-derived sign, weighted by log term frequency and L2-normalized. It
+// needs no network and is deterministic, for offline development and tests.
+// Its vectors only match lexically similar texts.
+type Hashing struct {
+	dimension int
+}
+
+// NewHashing returns a Hashing embedder producing vectors of dimension
+// entries.
+func NewHashing(dimension int) (*Hashing, error) {
+	if dimension == 0 {
+		dimension = DefaultHashingDimension
+	}
+	if dimension < 0 {
+		return nil, fmt.Errorf("embedding: negative dimension %d", dimension)
+	}
+	return &Hashing{dimension: dimension}, nil
+}
+
+// Model names the feature set and the dimension, which both determine the
+// vectors.
+func (h *Hashing) Model() string {
+	return fmt.Sprintf("hashing-ngram-v1-%d", h.dimension)
+}
+
+func (h *Hashing) Dimension() int {
+	return h.dimension
+}
+
+func (h *Hashing) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, 0, len(texts))
+	for _, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, h.embed(text))
+	}
+	return embeddings, nil
+}
+
+func (h *Hashing) embed(text string) []float64 {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		counts["w:"+word]++
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+word]++
+		}
+
+		// Trigrams of the padded word match inflections and compounds.
+		runes := []rune("<" + word + ">")
+		for j := 0; j+3 <= len(runes); j++ {
+			counts["c:"+string(runes[j:j+3])]++
+		}
+	}
+
+	vector := make([]float64, h.dimension)
+	for feature, count := range counts {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+
+		weight := 1 + math.Log(float64(count))
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[(sum&(1<<63-1))%uint64(h.dimension)] += weight
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+	return vector
+}
@@ -0,0 +1,112 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// dot is the cosine similarity of the unit vectors the embedder returns.
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func TestHashing(t *testing.T) {
+	tests := []struct {
+		name      string
+		dimension int
+		wantDim   int
+		wantModel string
+	}{
+		{name: "default", dimension: 0, wantDim: DefaultHashingDimension, wantModel: "hashing-ngram-v1-512"},
+		{name: "declared", dimension: 1408, wantDim: 1408, wantModel: "hashing-ngram-v1-1408"},
+		{name: "small", dimension: 16, wantDim: 16, wantModel: "hashing-ngram-v1-16"},
+	}
+
+	texts := []string{
+		"Sikaflex seals joints in concrete.",
+		"How long does the primer take to dry?",
+		"",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHashing(tt.dimension)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Dimension() != tt.wantDim || h.Model() != tt.wantModel {
+				t.Errorf("got %s of dimension %d, want %s of dimension %d", h.Model(), h.Dimension(), tt.wantModel, tt.wantDim)
+			}
+
+			first, err := h.Embed(context.Background(), texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := h.Embed(context.Background(), texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(first, second) {
+				t.Error("embeddings differ between calls")
+			}
+
+			for i, v := range first {
+				if len(v) != tt.wantDim {
+					t.Errorf("text %d: %d values, want %d", i, len(v), tt.wantDim)
+				}
+				norm := math.Sqrt(dot(v, v))
+				if texts[i] == "" {
+					if norm != 0 {
+						t.Errorf("empty text: norm %f, want 0", norm)
+					}
+				} else if math.Abs(norm-1) > 1e-9 {
+					t.Errorf("text %d: norm %f, want 1", i, norm)
+				}
+			}
+		})
+	}
+}
+
+func TestHashingSimilarity(t *testing.T) {
+	h, err := NewHashing(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := h.Embed(context.Background(), []string{
+		"How long does concrete take to cure?",
+		"how long does the concrete take to cure",
+		"Sika roofing membranes are waterproof.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	similar, unrelated := dot(v[0], v[1]), dot(v[0], v[2])
+	if similar <= unrelated || similar < 0.5 {
+		t.Errorf("similar texts score %f, unrelated ones %f", similar, unrelated)
+	}
+}
+
+func TestNewHashingNegative(t *testing.T) {
+	if _, err := NewHashing(-1); err == nil {
+		t.Error("NewHashing(-1) succeeded")
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	e, err := New(Config{Provider: ProviderHashing, Dimension: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Dimension() != 64 {
+		t.Errorf("dimension %d, want 64", e.Dimension())
+	}
+	if _, err := New(Config{Provider: "word2vec"}); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
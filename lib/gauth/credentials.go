@@ -0,0 +1,248 @@
+package gauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultTokenURL is the Google OAuth token endpoint.
+const defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// credentialsFile holds the fields of the JSON credential files of both
+// supported types.
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// FromFile returns the token source of a JSON credentials file: a service
+// account key or the authorized user credentials written by gcloud auth
+// application-default login.
+func FromFile(path string, scopes ...string) (TokenSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("gauth: reading credentials: %w", err)
+	}
+	return FromJSON(data, scopes...)
+}
+
+// FromJSON is FromFile for the contents of the file.
+func FromJSON(data []byte, scopes ...string) (TokenSource, error) {
+	var f credentialsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("gauth: parsing credentials: %w", err)
+	}
+
+	switch f.Type {
+	case "service_account":
+		key, err := parseKey(f.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return &ServiceAccount{
+			Email:    f.ClientEmail,
+			KeyID:    f.PrivateKeyID,
+			Key:      key,
+			Scopes:   scopes,
+			TokenURL: f.TokenURI,
+		}, nil
+	case "authorized_user":
+		return &AuthorizedUser{
+			ClientID:     f.ClientID,
+			ClientSecret: f.ClientSecret,
+			RefreshToken: f.RefreshToken,
+		}, nil
+	default:
+		return nil, fmt.Errorf("gauth: unsupported credentials type %q", f.Type)
+	}
+}
+
+func parseKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("gauth: private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("gauth: private key is not an RSA key")
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gauth: parsing private key: %w", err)
+	}
+	return key, nil
+}
+
+// ServiceAccount exchanges a JWT signed with the service account key for
+// an access token.
+type ServiceAccount struct {
+	Email  string
+	KeyID  string
+	Key    *rsa.PrivateKey
+	Scopes []string
+	// TokenURL defaults to the Google OAuth token endpoint.
+	TokenURL   string
+	HTTPClient *http.Client
+}
+
+// assertionLifetime is the validity of the signed JWT, the maximum Google
+// accepts.
+const assertionLifetime = time.Hour
+
+func (s *ServiceAccount) Token(ctx context.Context) (*Token, error) {
+	tokenURL := s.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	now := time.Now()
+	assertion, err := s.sign(map[string]interface{}{
+		"iss":   s.Email,
+		"scope": strings.Join(s.Scopes, " "),
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return exchange(ctx, s.HTTPClient, tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
+
+// sign returns the RS256 JWT of claims.
+func (s *ServiceAccount) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.KeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(nil, s.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("gauth: signing assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// AuthorizedUser refreshes the access token of a user who ran gcloud auth
+// application-default login.
+type AuthorizedUser struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	// TokenURL defaults to the Google OAuth token endpoint.
+	TokenURL   string
+	HTTPClient *http.Client
+}
+
+func (u *AuthorizedUser) Token(ctx context.Context) (*Token, error) {
+	tokenURL := u.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	return exchange(ctx, u.HTTPClient, tokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {u.ClientID},
+		"client_secret": {u.ClientSecret},
+		"refresh_token": {u.RefreshToken},
+	})
+}
+
+// TokenError is an error answer of the token endpoint.
+type TokenError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("gauth: token endpoint: status code %d: %s: %s", e.StatusCode, e.Code, e.Description)
+	}
+	return fmt.Sprintf("gauth: token endpoint: status code %d: %s", e.StatusCode, e.Code)
+}
+
+// exchange posts form to the token endpoint and returns the token granted.
+func exchange(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*Token, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		tokenErr := &TokenError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, tokenErr) != nil || tokenErr.Code == "" {
+			tokenErr.Code = strings.TrimSpace(string(body))
+		}
+		return nil, tokenErr
+	}
+
+	var granted struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &granted); err != nil {
+		return nil, fmt.Errorf("gauth: parsing token: %w", err)
+	}
+	if granted.AccessToken == "" {
+		return nil, errors.New("gauth: token endpoint granted no access token")
+	}
+
+	return &Token{
+		AccessToken: granted.AccessToken,
+		Expiry:      time.Now().Add(time.Duration(granted.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,137 @@
+package gauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeJWT verifies the RS256 signature of token and decodes its header
+// and claims.
+func decodeJWT(t *testing.T, token string, key *rsa.PublicKey) (header, claims map[string]interface{}) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion %q has %d parts, want 3", token, len(parts))
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("assertion signature: %v", err)
+	}
+
+	for i, v := range []*map[string]interface{}{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return header, claims
+}
+
+// serviceAccountKey returns a new key and its service account credentials
+// file for the token endpoint tokenURL.
+func serviceAccountKey(t *testing.T, tokenURL string) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentials, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "bot@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, credentials
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	var key *rsa.PrivateKey
+	var header, claims map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if got := r.PostForm.Get("grant_type"); got != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", got)
+		}
+		header, claims = decodeJWT(t, r.PostForm.Get("assertion"), &key.PublicKey)
+		w.Write([]byte(`{"access_token": "ya29.token", "expires_in": 3599, "token_type": "Bearer"}`))
+	}))
+	defer server.Close()
+
+	key, credentials := serviceAccountKey(t, server.URL)
+	source, err := FromJSON(credentials, CloudPlatformScope, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "ya29.token" {
+		t.Errorf("access token %q, want ya29.token", token.AccessToken)
+	}
+	if lifetime := token.Expiry.Sub(before); lifetime < 3598*time.Second || lifetime > 3600*time.Second {
+		t.Errorf("token expires in %v, want about 3599s", lifetime)
+	}
+
+	if header["alg"] != "RS256" || header["typ"] != "JWT" || header["kid"] != "key-1" {
+		t.Errorf("assertion header %v", header)
+	}
+	if claims["iss"] != "bot@project.iam.gserviceaccount.com" || claims["aud"] != server.URL ||
+		claims["scope"] != CloudPlatformScope+" email" {
+		t.Errorf("assertion claims %v", claims)
+	}
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if exp-iat != assertionLifetime.Seconds() || iat < float64(before.Unix()) {
+		t.Errorf("assertion issued at %v expires at %v", iat, exp)
+	}
+}
+
+func TestTokenError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`))
+	}))
+	defer server.Close()
+
+	user := &AuthorizedUser{ClientID: "id", ClientSecret: "secret", RefreshToken: "refresh", TokenURL: server.URL}
+	_, err := user.Token(context.Background())
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) || tokenErr.StatusCode != http.StatusBadRequest || tokenErr.Code != "invalid_grant" {
+		t.Errorf("Token() error = %v, want an invalid_grant TokenError", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Package gauth provides OAuth access tokens for Google Cloud APIs without
+// shelling out to gcloud on every request. Credentials come from a service
+// account key or the application default credentials; gcloud remains a
+// fallback for developer machines without either.
+package gauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudPlatformScope grants access to the Vertex AI APIs.
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// refreshBefore is how long before its expiry a cached token is replaced,
+// so that requests in flight never carry an expired one.
+const refreshBefore = 5 * time.Minute
+
+// Token is an OAuth access token.
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+func (t *Token) fresh(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && now.Add(refreshBefore).Before(t.Expiry)
+}
+
+// TokenSource fetches new access tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// Cached reuses the tokens of a source until shortly before they expire. It
+// is safe for concurrent use; concurrent callers wait for a single refresh.
+type Cached struct {
+	source TokenSource
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewCached returns a cache of the tokens of source.
+func NewCached(source TokenSource) *Cached {
+	return &Cached{source: source}
+}
+
+// Token returns the cached token, fetching a new one when it is about to
+// expire.
+func (c *Cached) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.fresh(time.Now()) {
+		return c.token, nil
+	}
+
+	token, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
+}
+
+// AccessToken returns the cached access token.
+func (c *Cached) AccessToken(ctx context.Context) (string, error) {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// ErrNoCredentials is returned by Default when no credentials are found.
+var ErrNoCredentials = errors.New("gauth: no credentials: set GOOGLE_APPLICATION_CREDENTIALS, run gcloud auth application-default login or install gcloud")
+
+// Default returns a cached token source for the application default
+// credentials, looked up in order:
+//
+//  1. the JSON key file named by GOOGLE_APPLICATION_CREDENTIALS;
+//  2. the file written by gcloud auth application-default login;
+//  3. gcloud auth print-access-token, when gcloud is installed.
+func Default(scopes ...string) (*Cached, error) {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		source, err := FromFile(path, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		return NewCached(source), nil
+	}
+
+	if path := wellKnownFile(); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			source, err := FromFile(path, scopes...)
+			if err != nil {
+				return nil, err
+			}
+			return NewCached(source), nil
+		}
+	}
+
+	if _, err := exec.LookPath("gcloud"); err == nil {
+		return NewCached(Gcloud{}), nil
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// wellKnownFile returns the path of the application default credentials
+// written by gcloud.
+func wellKnownFile() string {
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "gcloud", "application_default_credentials.json")
+		}
+		return ""
+	}
+	if config := os.Getenv("CLOUDSDK_CONFIG"); config != "" {
+		return filepath.Join(config, "application_default_credentials.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultSource *Cached
+)
+
+// DefaultAccessToken returns an access token of the cloud-platform scope
+// from the Default source, shared by the whole process.
+func DefaultAccessToken(ctx context.Context) (string, error) {
+	source, err := defaultCached()
+	if err != nil {
+		return "", err
+	}
+	return source.AccessToken(ctx)
+}
+
+// defaultCached looks up the Default source on first use. A failed lookup
+// is not kept, so that credentials set up later are found by the next call.
+func defaultCached() (*Cached, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultSource == nil {
+		source, err := Default(CloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+		defaultSource = source
+	}
+	return defaultSource, nil
+}
+
+// Gcloud fetches tokens with gcloud auth print-access-token.
+type Gcloud struct{}
+
+// gcloudLifetime is how long a gcloud token is assumed valid. gcloud may
+// hand out a token it cached itself, so its actual remaining lifetime is
+// unknown and may be much less than the hour of a new one.
+const gcloudLifetime = 10 * time.Minute
+
+func (Gcloud) Token(ctx context.Context) (*Token, error) {
+	out, err := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("gauth: gcloud: %w: %s", err, exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("gauth: gcloud: %w", err)
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return nil, errors.New("gauth: gcloud printed no token")
+	}
+	return &Token{AccessToken: token, Expiry: time.Now().Add(refreshBefore + gcloudLifetime)}, nil
+}
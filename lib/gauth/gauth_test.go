@@ -0,0 +1,103 @@
+package gauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer is a token endpoint granting tokens of the given lifetime,
+// numbered by request.
+func tokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "expires_in": %d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func authorizedUser(tokenURL string) *AuthorizedUser {
+	return &AuthorizedUser{ClientID: "id", ClientSecret: "secret", RefreshToken: "refresh", TokenURL: tokenURL}
+}
+
+func TestCachedRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn int
+		want      []string
+	}{
+		{name: "fresh token reused", expiresIn: 3600, want: []string{"token-1", "token-1", "token-1"}},
+		{name: "refreshed before expiry", expiresIn: int((refreshBefore - time.Minute).Seconds()), want: []string{"token-1", "token-2", "token-3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := tokenServer(t, tt.expiresIn)
+			cached := NewCached(authorizedUser(server.URL))
+			for i, want := range tt.want {
+				got, err := cached.AccessToken(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("call %d: token %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedConcurrent(t *testing.T) {
+	server, requests := tokenServer(t, 3600)
+	cached := NewCached(authorizedUser(server.URL))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cached.AccessToken(context.Background())
+			if err != nil || token != "token-1" {
+				t.Errorf("AccessToken() = %q, %v, want token-1", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("%d token requests, want 1", n)
+	}
+}
+
+func TestDefaultAccessTokenRetries(t *testing.T) {
+	t.Cleanup(func() { defaultSource = nil })
+	server, _ := tokenServer(t, 3600)
+
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	if _, err := DefaultAccessToken(context.Background()); err == nil {
+		t.Fatal("DefaultAccessToken() succeeded without credentials")
+	}
+
+	_, credentials := serviceAccountKey(t, server.URL)
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := DefaultAccessToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" {
+		t.Errorf("token %q, want token-1", token)
+	}
+}
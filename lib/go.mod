@@ -0,0 +1,3 @@
+module github.com/siriusfreak/hack-zurich-2023/lib
+
+go 1.19
@@ -0,0 +1,424 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// Elastic stores the documents in an Elasticsearch index with a
+// dense_vector embedding field.
+type Elastic struct {
+	indexURL      string
+	authorization string
+	client        *http.Client
+}
+
+// NewElastic returns the store of the index at indexURL. authorization is
+// the value of the Authorization header, empty for none.
+func NewElastic(indexURL, authorization string) *Elastic {
+	return &Elastic{indexURL: indexURL, authorization: authorization, client: &http.Client{}}
+}
+
+func (e *Elastic) Location() string {
+	return e.indexURL
+}
+
+func (e *Elastic) Close() error {
+	return nil
+}
+
+// StatusError is an Elasticsearch response with an error status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("vectorstore: elasticsearch: status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary tells whether the request may succeed when retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// do sends a request to path below the index URL and returns the body of
+// a 200 answer.
+func (e *Elastic) do(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.indexURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if e.authorization != "" {
+		req.Header.Set("Authorization", e.authorization)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return respBody, nil
+}
+
+func (e *Elastic) postJSON(ctx context.Context, path string, request interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return e.do(ctx, http.MethodPost, path, "application/json", bytes.NewBuffer(jsonData))
+}
+
+// bulk sends the NDJSON actions and fails on the first item whose status
+// is not accepted.
+func (e *Elastic) bulk(ctx context.Context, actions *bytes.Buffer, accepted func(status int) bool) error {
+	respBody, err := e.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", actions)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return err
+	}
+	for _, item := range result.Items {
+		for action, r := range item {
+			if !accepted(r.Status) {
+				return &StatusError{StatusCode: r.Status, Body: fmt.Sprintf("%s %s: %s", action, r.ID, r.Error)}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Elastic) Upsert(ctx context.Context, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range docs {
+		action := map[string]map[string]string{"index": {"_id": docs[i].ID}}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(&docs[i]); err != nil {
+			return err
+		}
+	}
+
+	return e.bulk(ctx, &body, func(status int) bool { return status < 300 })
+}
+
+func (e *Elastic) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	for _, id := range ids {
+		action := map[string]map[string]string{"delete": {"_id": id}}
+		if err := json.NewEncoder(&body).Encode(action); err != nil {
+			return err
+		}
+	}
+
+	return e.bulk(ctx, &body, func(status int) bool {
+		return status == http.StatusOK || status == http.StatusNotFound
+	})
+}
+
+func (e *Elastic) DeleteSourceFileExcept(ctx context.Context, sourceFile string, keep []string) error {
+	match := map[string]interface{}{
+		"filter": []interface{}{
+			map[string]interface{}{"term": map[string]string{FieldSourceFile: sourceFile}},
+		},
+	}
+	// An ids query of null values is invalid; without IDs to keep, all the
+	// chunks of the file go.
+	if len(keep) > 0 {
+		match["must_not"] = []interface{}{
+			map[string]interface{}{"ids": map[string][]string{"values": keep}},
+		}
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{"bool": match},
+	}
+	_, err := e.postJSON(ctx, "/_delete_by_query", query)
+	return err
+}
+
+// metadataMapping declares the filterable metadata fields, so that they are
+// indexed as exact keywords and dates instead of analyzed text.
+var metadataMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"document_id":      map[string]string{"type": "keyword"},
+		"page":             map[string]string{"type": "integer"},
+		"offset_end":       map[string]string{"type": "integer"},
+		"chunker":          map[string]string{"type": "keyword"},
+		"chunker_params":   map[string]string{"type": "keyword"},
+		"embedding_model":  map[string]string{"type": "keyword"},
+		"source_file":      map[string]string{"type": "keyword"},
+		"language":         map[string]string{"type": "keyword"},
+		"product_category": map[string]string{"type": "keyword"},
+		"document_type":    map[string]string{"type": "keyword"},
+		"document_date":    map[string]string{"type": "date", "format": "yyyy-MM-dd"},
+	},
+}
+
+// PutMetadataMapping adds the metadata fields to the mapping of the index.
+// Adding fields to an existing index is allowed by Elasticsearch.
+func (e *Elastic) PutMetadataMapping(ctx context.Context) error {
+	jsonData, err := json.Marshal(metadataMapping)
+	if err != nil {
+		return err
+	}
+	_, err = e.do(ctx, http.MethodPut, "/_mapping", "application/json", bytes.NewBuffer(jsonData))
+	return err
+}
+
+// EmbeddingDims returns the dimension the index declares for the embedding
+// field, or 0 when the field or the index is not mapped yet.
+func (e *Elastic) EmbeddingDims(ctx context.Context) (int, error) {
+	body, err := e.do(ctx, http.MethodGet, "/_mapping/field/embedding", "", nil)
+	if status, ok := err.(*StatusError); ok && status.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var indexes map[string]struct {
+		Mappings map[string]struct {
+			Mapping map[string]struct {
+				Dims int `json:"dims"`
+			} `json:"mapping"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(body, &indexes); err != nil {
+		return 0, err
+	}
+	for _, index := range indexes {
+		if field, ok := index.Mappings["embedding"]; ok {
+			return field.Mapping["embedding"].Dims, nil
+		}
+	}
+	return 0, nil
+}
+
+// PutEmbeddingMapping maps the embedding field as a dense vector of dims
+// values searchable by cosine similarity.
+func (e *Elastic) PutEmbeddingMapping(ctx context.Context, dims int) error {
+	mapping := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"embedding": map[string]interface{}{
+				"type":       "dense_vector",
+				"dims":       dims,
+				"index":      true,
+				"similarity": "cosine",
+			},
+		},
+	}
+	jsonData, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	_, err = e.do(ctx, http.MethodPut, "/_mapping", "application/json", bytes.NewBuffer(jsonData))
+	return err
+}
+
+// The subset of the Elasticsearch query DSL used by Search.
+
+type esKNN struct {
+	Field         string     `json:"field"`
+	QueryVector   []float64  `json:"query_vector"`
+	K             int        `json:"k"`
+	NumCandidates int        `json:"num_candidates"`
+	Boost         float64    `json:"boost,omitempty"`
+	Filter        []esFilter `json:"filter,omitempty"`
+}
+
+type esRange struct {
+	GTE string `json:"gte,omitempty"`
+	LTE string `json:"lte,omitempty"`
+}
+
+// esFilter is a non-scoring clause. Exactly one of its fields is set.
+type esFilter struct {
+	Terms map[string][]string `json:"terms,omitempty"`
+	Range map[string]esRange  `json:"range,omitempty"`
+}
+
+type esBoolQuery struct {
+	Must   []esQuery  `json:"must,omitempty"`
+	Filter []esFilter `json:"filter,omitempty"`
+}
+
+type esMatchField struct {
+	Query string  `json:"query"`
+	Boost float64 `json:"boost,omitempty"`
+}
+
+type esQuery struct {
+	Match map[string]esMatchField `json:"match,omitempty"`
+	Bool  *esBoolQuery            `json:"bool,omitempty"`
+}
+
+type esSearchRequest struct {
+	KNN   *esKNN   `json:"knn,omitempty"`
+	Query *esQuery `json:"query,omitempty"`
+	Size  int      `json:"size"`
+}
+
+// clauses translates the filter into Elasticsearch filter clauses, in field
+// order so that equal filters give equal requests.
+func (f Filter) clauses() []esFilter {
+	var clauses []esFilter
+	for _, field := range sortedKeys(f.Terms) {
+		if values := f.Terms[field]; len(values) > 0 {
+			clauses = append(clauses, esFilter{Terms: map[string][]string{field: values}})
+		}
+	}
+	for _, field := range sortedKeys(f.Ranges) {
+		r := f.Ranges[field]
+		clauses = append(clauses, esFilter{Range: map[string]esRange{field: {GTE: r.GTE, LTE: r.LTE}}})
+	}
+	return clauses
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func knnClause(q Query, boost float64) *esKNN {
+	return &esKNN{
+		Field:         "embedding",
+		QueryVector:   q.Vector,
+		K:             q.K,
+		NumCandidates: q.NumCandidates,
+		Boost:         boost,
+		Filter:        q.Filter.clauses(),
+	}
+}
+
+func matchClause(q Query, boost float64) *esQuery {
+	match := esQuery{
+		Match: map[string]esMatchField{
+			"content": {Query: q.Text, Boost: boost},
+		},
+	}
+	filters := q.Filter.clauses()
+	if len(filters) == 0 {
+		return &match
+	}
+
+	return &esQuery{
+		Bool: &esBoolQuery{
+			Must:   []esQuery{match},
+			Filter: filters,
+		},
+	}
+}
+
+func (e *Elastic) Search(ctx context.Context, q Query) ([]Hit, error) {
+	switch q.Mode {
+	case ModeKNN, "":
+		return e.search(ctx, esSearchRequest{KNN: knnClause(q, 0), Size: q.Size})
+	case ModeBM25:
+		return e.search(ctx, esSearchRequest{Query: matchClause(q, 0), Size: q.Size})
+	case ModeWeighted:
+		// A boost left out counts as 1, so a retriever weighted 0 is left
+		// out of the request instead.
+		request := esSearchRequest{Size: q.Size}
+		if q.VectorWeight > 0 {
+			request.KNN = knnClause(q, q.VectorWeight)
+		}
+		if q.TextWeight > 0 {
+			request.Query = matchClause(q, q.TextWeight)
+		}
+		if request.KNN == nil && request.Query == nil {
+			return nil, nil
+		}
+		return e.search(ctx, request)
+	case ModeRRF:
+		var lists [][]Hit
+		var weights []float64
+		if q.TextWeight > 0 {
+			hits, err := e.search(ctx, esSearchRequest{Query: matchClause(q, 0), Size: q.window()})
+			if err != nil {
+				return nil, fmt.Errorf("bm25 search: %w", err)
+			}
+			lists = append(lists, hits)
+			weights = append(weights, q.TextWeight)
+		}
+		if q.VectorWeight > 0 {
+			hits, err := e.search(ctx, esSearchRequest{KNN: knnClause(q, 0), Size: q.window()})
+			if err != nil {
+				return nil, fmt.Errorf("knn search: %w", err)
+			}
+			lists = append(lists, hits)
+			weights = append(weights, q.VectorWeight)
+		}
+		return FuseRRF(q.Size, q.rankConstant(), weights, lists...), nil
+	default:
+		return nil, fmt.Errorf("vectorstore: unknown retrieval mode %q", q.Mode)
+	}
+}
+
+func (e *Elastic) search(ctx context.Context, request esSearchRequest) ([]Hit, error) {
+	body, err := e.postJSON(ctx, "/_search", request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				ID     string   `json:"_id"`
+				Score  float64  `json:"_score"`
+				Source Document `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(response.Hits.Hits))
+	for _, h := range response.Hits.Hits {
+		h.Source.ID = h.ID
+		hits = append(hits, Hit{Document: h.Source, Score: h.Score})
+	}
+	return hits, nil
+}
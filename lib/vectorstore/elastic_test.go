@@ -0,0 +1,103 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// searchRequests runs the query against a fake index and returns the bodies
+// of the searches sent to it.
+func searchRequests(t *testing.T, q Query) []string {
+	t.Helper()
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/docs/_search" {
+			t.Errorf("request to %s, want /docs/_search", r.URL.Path)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		bodies = append(bodies, string(body))
+		w.Write([]byte(`{"hits": {"hits": []}}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewElastic(server.URL+"/docs", "").Search(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	return bodies
+}
+
+func TestElasticSearchRequests(t *testing.T) {
+	base := Query{Text: "primer", Vector: []float64{1, 0}, Size: 2, K: 3, NumCandidates: 10}
+	with := func(mode string, textWeight, vectorWeight float64) Query {
+		q := base
+		q.Mode, q.TextWeight, q.VectorWeight = mode, textWeight, vectorWeight
+		return q
+	}
+	filtered := with(ModeBM25, 0, 0)
+	filtered.Filter = Filter{Terms: map[string][]string{"language": {"de"}}}
+
+	const (
+		knn      = `{"field": "embedding", "query_vector": [1, 0], "k": 3, "num_candidates": 10}`
+		match    = `{"match": {"content": {"query": "primer"}}}`
+		knnRRF   = `{"knn": ` + knn + `, "size": 3}`
+		matchRRF = `{"query": ` + match + `, "size": 3}`
+	)
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"knn", with(ModeKNN, 0, 0), []string{`{"knn": ` + knn + `, "size": 2}`}},
+		{"bm25", with(ModeBM25, 0, 0), []string{`{"query": ` + match + `, "size": 2}`}},
+		{"bm25 filtered", filtered, []string{`{"query": {"bool": {
+			"must": [` + match + `],
+			"filter": [{"terms": {"language": ["de"]}}]}}, "size": 2}`}},
+		{"weighted", with(ModeWeighted, 0.3, 0.7), []string{`{
+			"knn": {"field": "embedding", "query_vector": [1, 0], "k": 3, "num_candidates": 10, "boost": 0.7},
+			"query": {"match": {"content": {"query": "primer", "boost": 0.3}}},
+			"size": 2}`}},
+		{"weighted without text", with(ModeWeighted, 0, 1), []string{`{
+			"knn": {"field": "embedding", "query_vector": [1, 0], "k": 3, "num_candidates": 10, "boost": 1},
+			"size": 2}`}},
+		{"weighted without vector", with(ModeWeighted, 0.5, 0), []string{`{
+			"query": {"match": {"content": {"query": "primer", "boost": 0.5}}},
+			"size": 2}`}},
+		{"weighted without retrievers", with(ModeWeighted, 0, 0), nil},
+		{"rrf", with(ModeRRF, 1, 1), []string{matchRRF, knnRRF}},
+		{"rrf without text", with(ModeRRF, 0, 1), []string{knnRRF}},
+		{"rrf without vector", with(ModeRRF, 1, 0), []string{matchRRF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchRequests(t, tt.q)
+			if len(got) != len(tt.want) {
+				t.Fatalf("sent %d searches %v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !sameJSON(t, got[i], tt.want[i]) {
+					t.Errorf("search %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func sameJSON(t *testing.T, a, b string) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal([]byte(a), &va); err != nil {
+		t.Fatalf("%s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &vb); err != nil {
+		t.Fatalf("%s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
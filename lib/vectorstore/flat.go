@@ -0,0 +1,521 @@
+package vectorstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// flatFormat identifies the file layout of Flat.
+const flatFormat = "vectorstore-flat-v1"
+
+// flatHeader is the first line of the file of a Flat store.
+type flatHeader struct {
+	Format         string `json:"format"`
+	EmbeddingModel string `json:"embedding_model"`
+	Dimension      int    `json:"dimension"`
+}
+
+// flatRecord is one change appended to the file of a Flat store.
+type flatRecord struct {
+	Op       string    `json:"op"`
+	ID       string    `json:"id,omitempty"`
+	Document *Document `json:"document,omitempty"`
+	IDs      []string  `json:"ids,omitempty"`
+}
+
+const (
+	opUpsert = "upsert"
+	opDelete = "delete"
+)
+
+// flatDoc is a document with the statistics of its content for BM25.
+type flatDoc struct {
+	Document
+	terms  map[string]int
+	length int
+}
+
+// Flat keeps the documents in memory and searches them exhaustively: exact
+// cosine similarity for vectors and BM25 for text, with the scores of
+// Elasticsearch. It suits up to some ten thousand chunks.
+//
+// Changes are appended to a JSON lines file, replayed by OpenFlat; the
+// file is compacted when most of it is outdated. The first line records the
+// embedding model and dimension, so that vectors of another model are
+// never mixed in.
+type Flat struct {
+	path           string
+	embeddingModel string
+	dimension      int
+
+	mu          sync.RWMutex
+	docs        map[string]*flatDoc
+	df          map[string]int
+	totalLength int
+	file        *os.File
+	records     int
+}
+
+// OpenFlat opens the store in the file at path, creating it when missing.
+// An existing file of another embedding model or dimension is refused.
+func OpenFlat(path, embeddingModel string, dimension int) (*Flat, error) {
+	if path == "" {
+		return nil, errors.New("vectorstore: no path for the flat store")
+	}
+
+	f := &Flat{
+		path:           path,
+		embeddingModel: embeddingModel,
+		dimension:      dimension,
+		docs:           make(map[string]*flatDoc),
+		df:             make(map[string]int),
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore: %w", err)
+	}
+	f.file = file
+
+	if err := f.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Compact once most of the records are outdated.
+	if f.records > 2*len(f.docs)+100 {
+		if err := f.compact(); err != nil {
+			f.file.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// load replays the file. A last line cut short by a crash is dropped.
+func (f *Flat) load() error {
+	reader := bufio.NewReader(f.file)
+	var offset int64
+
+	line, err := reader.ReadBytes('\n')
+	if len(line) == 0 && err == io.EOF {
+		return f.writeHeader()
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("vectorstore: reading %s: %w", f.path, err)
+	}
+
+	var header flatHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Format != flatFormat {
+		return fmt.Errorf("vectorstore: %s is not a flat store", f.path)
+	}
+	if f.embeddingModel != "" && header.EmbeddingModel != "" && header.EmbeddingModel != f.embeddingModel ||
+		f.dimension > 0 && header.Dimension > 0 && header.Dimension != f.dimension {
+		return fmt.Errorf("%w: %s holds %s embeddings of dimension %d, not %s of dimension %d",
+			ErrMismatch, f.path, header.EmbeddingModel, header.Dimension, f.embeddingModel, f.dimension)
+	}
+	if f.embeddingModel == "" {
+		f.embeddingModel = header.EmbeddingModel
+	}
+	if f.dimension == 0 {
+		f.dimension = header.Dimension
+	}
+	offset += int64(len(line))
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// An interrupted append.
+				if err := f.file.Truncate(offset); err != nil {
+					return fmt.Errorf("vectorstore: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("vectorstore: reading %s: %w", f.path, err)
+		}
+
+		var record flatRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("vectorstore: %s: corrupt record at offset %d: %w", f.path, offset, err)
+		}
+		f.apply(record)
+		f.records++
+		offset += int64(len(line))
+	}
+
+	_, err = f.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (f *Flat) writeHeader() error {
+	return json.NewEncoder(f.file).Encode(flatHeader{
+		Format:         flatFormat,
+		EmbeddingModel: f.embeddingModel,
+		Dimension:      f.dimension,
+	})
+}
+
+func (f *Flat) apply(record flatRecord) {
+	switch record.Op {
+	case opUpsert:
+		if record.Document != nil {
+			doc := *record.Document
+			doc.ID = record.ID
+			f.put(doc)
+		}
+	case opDelete:
+		for _, id := range record.IDs {
+			f.remove(id)
+		}
+	}
+}
+
+func (f *Flat) put(doc Document) {
+	f.remove(doc.ID)
+
+	d := &flatDoc{Document: doc, terms: make(map[string]int)}
+	for _, term := range tokenize(doc.Content) {
+		d.terms[term]++
+		d.length++
+	}
+	for term := range d.terms {
+		f.df[term]++
+	}
+	f.totalLength += d.length
+	f.docs[doc.ID] = d
+}
+
+func (f *Flat) remove(id string) {
+	d, ok := f.docs[id]
+	if !ok {
+		return
+	}
+	for term := range d.terms {
+		if f.df[term]--; f.df[term] == 0 {
+			delete(f.df, term)
+		}
+	}
+	f.totalLength -= d.length
+	delete(f.docs, id)
+}
+
+// appendRecords writes records to the file in one write.
+func (f *Flat) appendRecords(records []flatRecord) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := f.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("vectorstore: writing %s: %w", f.path, err)
+	}
+	f.records += len(records)
+	return nil
+}
+
+// compact rewrites the file with one record per document.
+func (f *Flat) compact() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("vectorstore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(flatHeader{Format: flatFormat, EmbeddingModel: f.embeddingModel, Dimension: f.dimension})
+	for id, d := range f.docs {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(flatRecord{Op: opUpsert, ID: id, Document: &d.Document})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("vectorstore: compacting %s: %w", f.path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("vectorstore: compacting %s: %w", f.path, err)
+	}
+	f.file.Close()
+	f.file, err = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("vectorstore: %w", err)
+	}
+	f.records = len(f.docs)
+	return nil
+}
+
+func (f *Flat) Location() string {
+	return f.path
+}
+
+func (f *Flat) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// Len returns the number of documents.
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.docs)
+}
+
+func (f *Flat) Upsert(ctx context.Context, docs []Document) error {
+	records := make([]flatRecord, 0, len(docs))
+	for i := range docs {
+		doc := &docs[i]
+		if doc.ID == "" {
+			return errors.New("vectorstore: document without ID")
+		}
+		if f.dimension > 0 && len(doc.Embedding) != f.dimension {
+			return fmt.Errorf("%w: document %s has %d values, the store holds %d",
+				ErrMismatch, doc.ID, len(doc.Embedding), f.dimension)
+		}
+		if f.embeddingModel != "" && doc.EmbeddingModel != "" && doc.EmbeddingModel != f.embeddingModel {
+			return fmt.Errorf("%w: document %s was embedded with %s, the store holds %s",
+				ErrMismatch, doc.ID, doc.EmbeddingModel, f.embeddingModel)
+		}
+		records = append(records, flatRecord{Op: opUpsert, ID: doc.ID, Document: doc})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.appendRecords(records); err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		f.put(doc)
+	}
+	return nil
+}
+
+func (f *Flat) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.delete(ids)
+}
+
+func (f *Flat) delete(ids []string) error {
+	if err := f.appendRecords([]flatRecord{{Op: opDelete, IDs: ids}}); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		f.remove(id)
+	}
+	return nil
+}
+
+func (f *Flat) DeleteSourceFileExcept(ctx context.Context, sourceFile string, keep []string) error {
+	kept := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ids []string
+	for id, d := range f.docs {
+		if d.SourceFile == sourceFile && !kept[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return f.delete(ids)
+}
+
+func (f *Flat) Search(ctx context.Context, q Query) ([]Hit, error) {
+	if q.Mode != ModeBM25 && f.dimension > 0 && len(q.Vector) != f.dimension {
+		return nil, fmt.Errorf("%w: query vector has %d values, the store holds %d", ErrMismatch, len(q.Vector), f.dimension)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var candidates []*flatDoc
+	for _, d := range f.docs {
+		if q.Filter.matches(&d.Document) {
+			candidates = append(candidates, d)
+		}
+	}
+
+	switch q.Mode {
+	case ModeKNN, "":
+		return top(f.vectorScores(q, candidates), q.Size), nil
+	case ModeBM25:
+		return top(f.textScores(q, candidates), q.Size), nil
+	case ModeWeighted:
+		// Like Elasticsearch, the K nearest neighbours and the text matches
+		// are combined, summing the scores of documents found by both. A
+		// retriever weighted 0 is left out.
+		scores := make(map[string]*Hit)
+		var vectorHits, textHits []Hit
+		if q.VectorWeight > 0 {
+			vectorHits = top(f.vectorScores(q, candidates), q.K)
+		}
+		if q.TextWeight > 0 {
+			textHits = f.textScores(q, candidates)
+		}
+		for _, hit := range vectorHits {
+			hit := hit
+			hit.Score *= q.VectorWeight
+			scores[hit.ID] = &hit
+		}
+		for _, hit := range textHits {
+			if h, ok := scores[hit.ID]; ok {
+				h.Score += q.TextWeight * hit.Score
+				continue
+			}
+			hit := hit
+			hit.Score *= q.TextWeight
+			scores[hit.ID] = &hit
+		}
+		hits := make([]Hit, 0, len(scores))
+		for _, hit := range scores {
+			hits = append(hits, *hit)
+		}
+		return top(hits, q.Size), nil
+	case ModeRRF:
+		var lists [][]Hit
+		var weights []float64
+		if q.TextWeight > 0 {
+			lists = append(lists, top(f.textScores(q, candidates), q.window()))
+			weights = append(weights, q.TextWeight)
+		}
+		if q.VectorWeight > 0 {
+			lists = append(lists, top(f.vectorScores(q, candidates), q.window()))
+			weights = append(weights, q.VectorWeight)
+		}
+		return FuseRRF(q.Size, q.rankConstant(), weights, lists...), nil
+	default:
+		return nil, fmt.Errorf("vectorstore: unknown retrieval mode %q", q.Mode)
+	}
+}
+
+// vectorScores scores the candidates like the cosine similarity of
+// Elasticsearch: (1 + cosine) / 2.
+func (f *Flat) vectorScores(q Query, candidates []*flatDoc) []Hit {
+	queryNorm := norm(q.Vector)
+	hits := make([]Hit, 0, len(candidates))
+	for _, d := range candidates {
+		docNorm := norm(d.Embedding)
+		if queryNorm == 0 || docNorm == 0 || len(d.Embedding) != len(q.Vector) {
+			continue
+		}
+		var dot float64
+		for i, v := range q.Vector {
+			dot += v * d.Embedding[i]
+		}
+		hits = append(hits, Hit{Document: d.Document, Score: (1 + dot/(queryNorm*docNorm)) / 2})
+	}
+	return hits
+}
+
+// BM25 parameters of Elasticsearch.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// textScores scores the candidates matching a query term with BM25. Term
+// statistics cover the whole store, like those of an Elasticsearch shard.
+func (f *Flat) textScores(q Query, candidates []*flatDoc) []Hit {
+	terms := tokenize(q.Text)
+	if len(terms) == 0 || len(f.docs) == 0 {
+		return nil
+	}
+	n := float64(len(f.docs))
+	avgLength := float64(f.totalLength) / n
+
+	var hits []Hit
+	for _, d := range candidates {
+		var score float64
+		for _, term := range terms {
+			tf := float64(d.terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(f.df[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.length)/avgLength))
+		}
+		if score > 0 {
+			hits = append(hits, Hit{Document: d.Document, Score: score})
+		}
+	}
+	return hits
+}
+
+// top returns the size best hits, best first. Ties are broken by ID to keep
+// results stable.
+func top(hits []Hit, size int) []Hit {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if size >= 0 && len(hits) > size {
+		hits = hits[:size]
+	}
+	return hits
+}
+
+func norm(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+// tokenize splits text into lowercase words, roughly like the standard
+// analyzer of Elasticsearch.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,199 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var flatDocs = []Document{
+	{ID: "roof", Content: "Sika roofing membranes are waterproof.", Embedding: []float64{1, 0, 0},
+		SourceFile: "Roofing/membranes.pdf", Language: "en", DocumentDate: "2021-03-01"},
+	{ID: "primer", Content: "Apply the primer before the membrane.", Embedding: []float64{0.8, 0.6, 0},
+		SourceFile: "Roofing/membranes.pdf", Language: "en", DocumentDate: "2021-03-01"},
+	{ID: "concrete", Content: "Concrete takes a day to cure.", Embedding: []float64{0, 0, 1},
+		SourceFile: "Concrete/curing.pdf", Language: "en", DocumentDate: "2023-06-01"},
+	{ID: "beton", Content: "Beton braucht einen Tag zum Aushärten.", Embedding: []float64{0, 0.1, 1},
+		SourceFile: "Concrete/aushaerten.pdf", Language: "de", DocumentDate: "2023-06-01"},
+}
+
+func openTestFlat(t *testing.T, path string) *Flat {
+	t.Helper()
+	f, err := OpenFlat(path, "test-model", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func searchIDs(t *testing.T, f *Flat, q Query) []string {
+	t.Helper()
+	found, err := f.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids(found)
+}
+
+func TestFlatSearch(t *testing.T) {
+	f := openTestFlat(t, filepath.Join(t.TempDir(), "store.jsonl"))
+	defer f.Close()
+	if err := f.Upsert(context.Background(), flatDocs); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{
+			name: "knn",
+			q:    Query{Mode: ModeKNN, Vector: []float64{1, 0.1, 0}, K: 10, Size: 2},
+			want: []string{"roof", "primer"},
+		},
+		{
+			name: "bm25",
+			q:    Query{Mode: ModeBM25, Text: "cure concrete", Size: 3},
+			want: []string{"concrete"},
+		},
+		{
+			name: "weighted",
+			q:    Query{Mode: ModeWeighted, Text: "primer", Vector: []float64{0, 0, 1}, K: 10, Size: 1, TextWeight: 5, VectorWeight: 1},
+			want: []string{"primer"},
+		},
+		{
+			name: "weighted without vector",
+			q:    Query{Mode: ModeWeighted, Text: "primer", Vector: []float64{0, 0, 1}, K: 10, Size: 4, TextWeight: 1, VectorWeight: 0},
+			want: []string{"primer"},
+		},
+		{
+			name: "weighted without text",
+			q:    Query{Mode: ModeWeighted, Text: "primer", Vector: []float64{0, 0, 1}, K: 2, Size: 4, TextWeight: 0, VectorWeight: 1},
+			want: []string{"concrete", "beton"},
+		},
+		{
+			name: "rrf",
+			q:    Query{Mode: ModeRRF, Text: "membrane primer", Vector: []float64{1, 0, 0}, K: 10, Size: 2, TextWeight: 1, VectorWeight: 1},
+			want: []string{"primer", "roof"},
+		},
+		{
+			name: "rrf without text",
+			q:    Query{Mode: ModeRRF, Text: "membrane primer", Vector: []float64{0, 0, 1}, K: 10, Size: 1, TextWeight: 0, VectorWeight: 1},
+			want: []string{"concrete"},
+		},
+		{
+			name: "term filter",
+			q: Query{Mode: ModeKNN, Vector: []float64{0, 0, 1}, K: 10, Size: 3,
+				Filter: Filter{Terms: map[string][]string{FieldLanguage: {"de"}}}},
+			want: []string{"beton"},
+		},
+		{
+			name: "date filter",
+			q: Query{Mode: ModeKNN, Vector: []float64{0, 0, 1}, K: 10, Size: 4,
+				Filter: Filter{Ranges: map[string]Range{FieldDocumentDate: {LTE: "2022-01-01"}}}},
+			want: []string{"primer", "roof"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchIDs(t, f, tt.q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlatDeleteAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	ctx := context.Background()
+
+	f := openTestFlat(t, path)
+	if err := f.Upsert(ctx, flatDocs); err != nil {
+		t.Fatal(err)
+	}
+	updated := flatDocs[2]
+	updated.Content = "Concrete cures in 28 days."
+	if err := f.Upsert(ctx, []Document{updated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete(ctx, []string{"beton", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DeleteSourceFileExcept(ctx, "Roofing/membranes.pdf", []string{"roof"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DeleteSourceFileExcept(ctx, "Nothing/left.pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 2 {
+		t.Errorf("%d documents, want 2", f.Len())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash in the middle of an append leaves a torn line, dropped on load.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"op":"upsert","id":"torn","document":{"content":`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	f = openTestFlat(t, path)
+	defer f.Close()
+	if f.Len() != 2 {
+		t.Errorf("%d documents after reload, want 2", f.Len())
+	}
+	found, err := f.Search(ctx, Query{Mode: ModeBM25, Text: "concrete days", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != "concrete" || found[0].Content != updated.Content {
+		t.Errorf("Search() after reload = %+v, want the updated concrete chunk", found)
+	}
+	if got := searchIDs(t, f, Query{Mode: ModeKNN, Vector: []float64{1, 0, 0}, K: 10, Size: 5}); !reflect.DeepEqual(got, []string{"roof", "concrete"}) {
+		t.Errorf("Search() after reload = %v, want [roof concrete]", got)
+	}
+
+	// The store stays writable after dropping the torn line.
+	if err := f.Upsert(ctx, flatDocs[3:]); err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 3 {
+		t.Errorf("%d documents, want 3", f.Len())
+	}
+}
+
+func TestFlatMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	f := openTestFlat(t, path)
+
+	wrong := Document{ID: "short", Embedding: []float64{1, 0}}
+	if err := f.Upsert(context.Background(), []Document{wrong}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Upsert of a 2-value embedding: %v, want ErrMismatch", err)
+	}
+	if _, err := f.Search(context.Background(), Query{Mode: ModeKNN, Vector: []float64{1}, Size: 1}); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Search with a 1-value vector: %v, want ErrMismatch", err)
+	}
+	f.Close()
+
+	for _, tt := range []struct {
+		model     string
+		dimension int
+	}{
+		{"other-model", 3},
+		{"test-model", 768},
+	} {
+		if _, err := OpenFlat(path, tt.model, tt.dimension); !errors.Is(err, ErrMismatch) {
+			t.Errorf("OpenFlat(%s, %d): %v, want ErrMismatch", tt.model, tt.dimension, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Package vectorstore stores the embedded document chunks and retrieves
+// them for the chat backend. Elastic keeps them in an Elasticsearch index;
+// Flat keeps them in process, persisted to a file, for small deployments
+// and CI without a cluster.
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Document is an indexed chunk of a PDF. The JSON names are the
+// Elasticsearch field names.
+type Document struct {
+	ID        string    `json:"-"`
+	Content   string    `json:"content"`
+	Links     []string  `json:"links"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+	Embedding []float64 `json:"embedding"`
+	// Offset and OffsetEnd are the character range of the chunk in the text
+	// of the PDF.
+	Offset    int `json:"offset"`
+	OffsetEnd int `json:"offset_end"`
+
+	// DocumentID and Page locate the chunk in the PDF served by the chat
+	// backend.
+	DocumentID string `json:"document_id"`
+	Page       int    `json:"page"`
+
+	// Chunker, ChunkerParams and EmbeddingModel record how the chunk was cut
+	// and embedded.
+	Chunker        string `json:"chunker"`
+	ChunkerParams  string `json:"chunker_params"`
+	EmbeddingModel string `json:"embedding_model"`
+
+	// Metadata the chat backend filters on.
+	SourceFile      string `json:"source_file"`
+	Language        string `json:"language"`
+	ProductCategory string `json:"product_category"`
+	DocumentType    string `json:"document_type"`
+	DocumentDate    string `json:"document_date,omitempty"`
+}
+
+// Names of the filterable fields.
+const (
+	FieldSourceFile      = "source_file"
+	FieldLanguage        = "language"
+	FieldProductCategory = "product_category"
+	FieldDocumentType    = "document_type"
+	FieldDocumentDate    = "document_date"
+	FieldDocumentID      = "document_id"
+	FieldEmbeddingModel  = "embedding_model"
+)
+
+// field returns the value of a filterable field.
+func (d *Document) field(name string) string {
+	switch name {
+	case FieldSourceFile:
+		return d.SourceFile
+	case FieldLanguage:
+		return d.Language
+	case FieldProductCategory:
+		return d.ProductCategory
+	case FieldDocumentType:
+		return d.DocumentType
+	case FieldDocumentDate:
+		return d.DocumentDate
+	case FieldDocumentID:
+		return d.DocumentID
+	case FieldEmbeddingModel:
+		return d.EmbeddingModel
+	}
+	return ""
+}
+
+// Hit is a retrieved document.
+type Hit struct {
+	Document
+	Score float64
+}
+
+// Retrieval modes of Query.
+const (
+	ModeKNN      = "knn"
+	ModeBM25     = "bm25"
+	ModeWeighted = "weighted"
+	ModeRRF      = "rrf"
+)
+
+// Query combines a full-text match on the content with a nearest neighbour
+// search on the embedding. Exact product codes like "Sikaflex-11 FC" are
+// found by the text match, paraphrases by the vector search.
+type Query struct {
+	Text   string
+	Vector []float64
+
+	// Mode is one of ModeKNN, ModeBM25, ModeWeighted and ModeRRF.
+	//   weighted: scores are TextWeight*bm25 + VectorWeight*knn.
+	//   rrf:      the retrievers run separately, fused by reciprocal rank.
+	Mode string
+	// K nearest neighbours are found among NumCandidates per shard.
+	K             int
+	NumCandidates int
+	Size          int
+	// TextWeight and VectorWeight scale the retrievers in the weighted and
+	// rrf modes. A weight of 0 turns its retriever off.
+	TextWeight   float64
+	VectorWeight float64
+	// RankConstant is the k of reciprocal rank fusion, 60 when unset.
+	RankConstant int
+	// Filter restricts both retrievers without affecting scores.
+	Filter Filter
+}
+
+const defaultRankConstant = 60
+
+func (q Query) rankConstant() int {
+	if q.RankConstant <= 0 {
+		return defaultRankConstant
+	}
+	return q.RankConstant
+}
+
+// window is how many hits every retriever contributes to the fusion.
+func (q Query) window() int {
+	if q.K > q.Size {
+		return q.K
+	}
+	return q.Size
+}
+
+// Range bounds a date field, as YYYY-MM-DD, inclusive. Empty bounds are
+// open.
+type Range struct {
+	GTE string
+	LTE string
+}
+
+// Filter narrows a search to documents with matching metadata.
+type Filter struct {
+	// Terms maps fields to their accepted values.
+	Terms map[string][]string
+	// Ranges maps date fields to their bounds.
+	Ranges map[string]Range
+}
+
+func (f Filter) matches(d *Document) bool {
+	for field, values := range f.Terms {
+		if len(values) == 0 {
+			continue
+		}
+		value := d.field(field)
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for field, r := range f.Ranges {
+		value := d.field(field)
+		if value == "" {
+			return false
+		}
+		if r.GTE != "" && value < r.GTE || r.LTE != "" && value > r.LTE {
+			return false
+		}
+	}
+	return true
+}
+
+// VectorStore stores documents and searches them.
+type VectorStore interface {
+	// Upsert adds the documents, replacing those with the same IDs.
+	Upsert(ctx context.Context, docs []Document) error
+	// Delete removes the documents with the given IDs. Missing documents are
+	// not an error.
+	Delete(ctx context.Context, ids []string) error
+	// DeleteSourceFileExcept removes the documents of sourceFile, except
+	// those with the keep IDs.
+	DeleteSourceFileExcept(ctx context.Context, sourceFile string, keep []string) error
+	// Search returns at most q.Size hits, best first.
+	Search(ctx context.Context, q Query) ([]Hit, error)
+	// Location identifies the store, e.g. in log messages.
+	Location() string
+	Close() error
+}
+
+// Kinds of store accepted by Open.
+const (
+	KindElasticsearch = "elasticsearch"
+	KindFlat          = "flat"
+)
+
+// Config selects and configures a store.
+type Config struct {
+	// Kind is KindElasticsearch, the default, or KindFlat.
+	Kind string
+
+	// IndexURL and Authorization address the Elasticsearch index.
+	IndexURL      string
+	Authorization string
+
+	// Path is the file of the flat store.
+	Path string
+	// EmbeddingModel and Dimension describe the vectors of the flat store.
+	// An existing file of another model or dimension is refused.
+	EmbeddingModel string
+	Dimension      int
+}
+
+// Open returns the store configured by cfg.
+func Open(cfg Config) (VectorStore, error) {
+	switch cfg.Kind {
+	case KindElasticsearch, "":
+		if cfg.IndexURL == "" {
+			return nil, errors.New("vectorstore: no index URL")
+		}
+		return NewElastic(cfg.IndexURL, cfg.Authorization), nil
+	case KindFlat:
+		return OpenFlat(cfg.Path, cfg.EmbeddingModel, cfg.Dimension)
+	default:
+		return nil, fmt.Errorf("vectorstore: unknown kind %q (known: %s, %s)", cfg.Kind, KindElasticsearch, KindFlat)
+	}
+}
+
+// ErrMismatch is returned when vectors of another model or dimension meet
+// the store.
+var ErrMismatch = errors.New("vectorstore: embedding mismatch")
+
+// FuseRRF merges ranked hit lists with reciprocal rank fusion: a hit scores
+// the sum over lists of weight / (rankConstant + rank). Lists without a
+// weight count once, lists weighted 0 or less are left out. It returns at
+// most size hits, best first.
+func FuseRRF(size int, rankConstant int, weights []float64, lists ...[]Hit) []Hit {
+	scores := make(map[string]float64)
+	hits := make(map[string]Hit)
+	var order []string
+	for i, list := range lists {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		if weight <= 0 {
+			continue
+		}
+		for rank, hit := range list {
+			if _, seen := hits[hit.ID]; !seen {
+				hits[hit.ID] = hit
+				order = append(order, hit.ID)
+			}
+			scores[hit.ID] += weight / float64(rankConstant+rank+1)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	if len(order) > size {
+		order = order[:size]
+	}
+
+	fused := make([]Hit, 0, len(order))
+	for _, id := range order {
+		hit := hits[id]
+		hit.Score = scores[id]
+		fused = append(fused, hit)
+	}
+	return fused
+}
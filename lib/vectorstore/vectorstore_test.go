@@ -0,0 +1,114 @@
+package vectorstore
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func hits(ids ...string) []Hit {
+	list := make([]Hit, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, Hit{Document: Document{ID: id}})
+	}
+	return list
+}
+
+func ids(list []Hit) []string {
+	out := make([]string, 0, len(list))
+	for _, h := range list {
+		out = append(out, h.ID)
+	}
+	return out
+}
+
+func TestFuseRRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		weights    []float64
+		lists      [][]Hit
+		want       []string
+		wantScores []float64
+	}{
+		{
+			// Ties keep the order the hits were first seen in.
+			name:       "shared hits first",
+			size:       10,
+			lists:      [][]Hit{hits("a", "b", "c"), hits("c", "d")},
+			want:       []string{"c", "a", "b", "d"},
+			wantScores: []float64{1.0/63 + 1.0/61, 1.0 / 61, 1.0 / 62, 1.0 / 62},
+		},
+		{
+			name:    "size",
+			size:    2,
+			lists:   [][]Hit{hits("a", "b", "c"), hits("c", "d")},
+			want:    []string{"c", "a"},
+			weights: []float64{1, 1},
+		},
+		{
+			name:       "weights",
+			size:       10,
+			weights:    []float64{1, 3},
+			lists:      [][]Hit{hits("a", "b"), hits("b", "c")},
+			want:       []string{"b", "c", "a"},
+			wantScores: []float64{1.0/62 + 3.0/61, 3.0 / 62, 1.0 / 61},
+		},
+		{
+			name:       "zero weight turns a list off",
+			size:       10,
+			weights:    []float64{0, 1},
+			lists:      [][]Hit{hits("a", "b"), hits("c")},
+			want:       []string{"c"},
+			wantScores: []float64{1.0 / 61},
+		},
+		{
+			name:    "missing weights count once",
+			size:    10,
+			weights: []float64{2},
+			lists:   [][]Hit{hits("a"), hits("b")},
+			want:    []string{"a", "b"},
+		},
+		{
+			name:  "no hits",
+			size:  10,
+			lists: [][]Hit{nil, nil},
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FuseRRF(tt.size, 60, tt.weights, tt.lists...)
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Fatalf("FuseRRF() = %v, want %v", ids(got), tt.want)
+			}
+			for i, score := range tt.wantScores {
+				if math.Abs(got[i].Score-score) > 1e-12 {
+					t.Errorf("hit %s: score %g, want %g", got[i].ID, got[i].Score, score)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	doc := &Document{Language: "en", ProductCategory: "Roofing", DocumentDate: "2022-05-01"}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty", filter: Filter{}, want: true},
+		{name: "term", filter: Filter{Terms: map[string][]string{FieldLanguage: {"de", "en"}}}, want: true},
+		{name: "other term", filter: Filter{Terms: map[string][]string{FieldLanguage: {"de"}}}, want: false},
+		{name: "in range", filter: Filter{Ranges: map[string]Range{FieldDocumentDate: {GTE: "2022-01-01", LTE: "2022-12-31"}}}, want: true},
+		{name: "open range", filter: Filter{Ranges: map[string]Range{FieldDocumentDate: {GTE: "2023-01-01"}}}, want: false},
+		{name: "undated", filter: Filter{Ranges: map[string]Range{FieldSourceFile: {GTE: "a"}}}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(doc); got != tt.want {
+			t.Errorf("%s: matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
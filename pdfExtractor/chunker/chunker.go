@@ -0,0 +1,284 @@
+package chunker
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Chunk is a piece of the text of a PDF. Start and End are rune offsets
+// into the whole text.
+type Chunk struct {
+	Text  string
+	Page  int
+	Start int
+	End   int
+}
+
+// Chunker splits the text of a PDF, as produced by pdftotext, into chunks.
+// Name and Params are indexed with every chunk so that retrieval quality
+// can be compared between strategies.
+type Chunker interface {
+	Chunk(text string) []Chunk
+	Name() string
+	Params() string
+}
+
+// Options size the chunks, in the unit of the strategy: runes, or tokens
+// for the token strategy. A Size of 0 or a negative Overlap picks the
+// strategy default; an Overlap of 0 repeats nothing between chunks.
+type Options struct {
+	Size    int
+	Overlap int
+}
+
+// Names of the chunking strategies.
+const (
+	StrategyWindow    = "window"
+	StrategySentence  = "sentence"
+	StrategyRecursive = "recursive"
+	StrategyToken     = "token"
+)
+
+// Strategies lists the names accepted by New.
+func Strategies() []string {
+	return []string{StrategyWindow, StrategySentence, StrategyRecursive, StrategyToken}
+}
+
+// New returns the chunker of the named strategy.
+func New(strategy string, opts Options) (Chunker, error) {
+	var c Chunker
+	var size, overlap int
+	switch strategy {
+	case StrategyWindow:
+		w := &Window{Size: sizeOrDefault(opts.Size, 800), Overlap: overlapOrDefault(opts.Overlap, 400)}
+		c, size, overlap = w, w.Size, w.Overlap
+	case StrategySentence:
+		s := &Sentence{Size: sizeOrDefault(opts.Size, 800), Overlap: overlapOrDefault(opts.Overlap, 200)}
+		c, size, overlap = s, s.Size, s.Overlap
+	case StrategyRecursive:
+		r := &Recursive{Size: sizeOrDefault(opts.Size, 800), Overlap: overlapOrDefault(opts.Overlap, 200)}
+		c, size, overlap = r, r.Size, r.Overlap
+	case StrategyToken:
+		t := &Token{MaxTokens: sizeOrDefault(opts.Size, EmbeddingTokenLimit), Overlap: overlapOrDefault(opts.Overlap, 8)}
+		c, size, overlap = t, t.MaxTokens, t.Overlap
+	default:
+		return nil, fmt.Errorf("unknown chunking strategy %q (known: %v)", strategy, Strategies())
+	}
+
+	if size <= 0 || overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("invalid %s chunking: size %d, overlap %d", strategy, size, overlap)
+	}
+	return c, nil
+}
+
+func sizeOrDefault(size, def int) int {
+	if size == 0 {
+		return def
+	}
+	return size
+}
+
+func overlapOrDefault(overlap, def int) int {
+	if overlap < 0 {
+		return def
+	}
+	return overlap
+}
+
+func params(size, overlap int) string {
+	return fmt.Sprintf("size=%d,overlap=%d", size, overlap)
+}
+
+// headingLength is the line length below which a line without final
+// punctuation is taken for a heading or a table row and kept on its own.
+const headingLength = 60
+
+// unit is a sentence, a heading, a table row or a separator-delimited
+// piece: the smallest piece of text a chunker keeps together.
+type unit struct {
+	start, end int
+	// paragraph tells whether the unit starts a paragraph.
+	paragraph bool
+}
+
+// measure returns the size of runes[start:end] in the unit of a strategy.
+type measure func(start, end int) int
+
+func runeCount(start, end int) int {
+	return end - start
+}
+
+// pages returns the spans of the pages of runes. pdftotext ends every page
+// with a form feed.
+func pages(runes []rune) []unit {
+	var spans []unit
+	start := 0
+	for i, r := range runes {
+		if r == '\f' {
+			spans = append(spans, unit{start: start, end: i})
+			start = i + 1
+		}
+	}
+	return append(spans, unit{start: start, end: len(runes)})
+}
+
+// chunksOf turns the spans packed on page into chunks.
+func chunksOf(runes []rune, page int, spans []unit) []Chunk {
+	chunks := make([]Chunk, 0, len(spans))
+	for _, u := range spans {
+		chunks = append(chunks, Chunk{
+			Text:  string(runes[u.start:u.end]),
+			Page:  page,
+			Start: u.start,
+			End:   u.end,
+		})
+	}
+	return chunks
+}
+
+// splitUnits splits runes[start:end] into sentence units. Units measuring
+// more than size are cut at whitespace.
+func splitUnits(runes []rune, start, end, size int, m measure) []unit {
+	var units []unit
+	unitStart := -1
+	paragraph := true
+	lineStart := start
+
+	closeUnit := func(at int) {
+		if unitStart < 0 {
+			return
+		}
+		at = trimRight(runes, unitStart, at)
+		if at > unitStart {
+			units = append(units, splitLong(runes, unit{start: unitStart, end: at, paragraph: paragraph}, size, m)...)
+			paragraph = false
+		}
+		unitStart = -1
+	}
+
+	for i := start; i < end; i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			if blankLineFollows(runes, i+1, end) {
+				closeUnit(i)
+				paragraph = true
+			} else if i-lineStart < headingLength && !endsSentence(runes, lineStart, i) {
+				closeUnit(i)
+			}
+			lineStart = i + 1
+		case unitStart < 0:
+			if !unicode.IsSpace(r) {
+				unitStart = i
+			}
+		case r == '.' || r == '!' || r == '?':
+			if i+1 == end || unicode.IsSpace(runes[i+1]) {
+				closeUnit(i + 1)
+			}
+		}
+	}
+	closeUnit(end)
+
+	return units
+}
+
+// blankLineFollows tells whether the line starting at i is empty.
+func blankLineFollows(runes []rune, i, end int) bool {
+	for ; i < end; i++ {
+		switch runes[i] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// endsSentence tells whether runes[start:end] ends with sentence punctuation.
+func endsSentence(runes []rune, start, end int) bool {
+	end = trimRight(runes, start, end)
+	if end == start {
+		return false
+	}
+	switch runes[end-1] {
+	case '.', '!', '?', ':', ';':
+		return true
+	}
+	return false
+}
+
+func trimRight(runes []rune, start, end int) int {
+	for end > start && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+	return end
+}
+
+// splitLong cuts u into pieces measuring at most size, at whitespace. A
+// single word measuring more than size is a piece of its own.
+func splitLong(runes []rune, u unit, size int, m measure) []unit {
+	if size <= 0 || m(u.start, u.end) <= size {
+		return []unit{u}
+	}
+
+	var pieces []unit
+	start, end := u.start, u.start
+	for i := u.start; i <= u.end; i++ {
+		if i < u.end && !unicode.IsSpace(runes[i]) {
+			continue
+		}
+		// A word ends at i.
+		if end > start && m(start, i) > size {
+			pieces = append(pieces, unit{start: start, end: end, paragraph: len(pieces) == 0 && u.paragraph})
+			start = end
+			for start < i && unicode.IsSpace(runes[start]) {
+				start++
+			}
+		}
+		end = trimRight(runes, start, i)
+	}
+	if end > start {
+		pieces = append(pieces, unit{start: start, end: end, paragraph: len(pieces) == 0 && u.paragraph})
+	}
+	return pieces
+}
+
+// packUnits groups consecutive units into chunk spans measuring at most
+// size. A chunk is closed early at a paragraph once it is half full. Every
+// chunk but the first starts with the trailing units of the previous one
+// that fit into overlap.
+func packUnits(units []unit, size, overlap int, m measure) []unit {
+	var spans []unit
+	first := 0
+	for first < len(units) {
+		last := first
+		for last+1 < len(units) {
+			next := units[last+1]
+			if m(units[first].start, next.end) > size {
+				break
+			}
+			if next.paragraph && m(units[first].start, units[last].end) >= size/2 {
+				break
+			}
+			last++
+		}
+		spans = append(spans, unit{start: units[first].start, end: units[last].end})
+
+		if last+1 == len(units) {
+			break
+		}
+
+		// Step back over the units repeated as overlap, as far as they
+		// leave room for the next new unit and always making progress.
+		next := last + 1
+		for next-1 > first && m(units[next-1].start, units[last].end) <= overlap &&
+			m(units[next-1].start, units[last+1].end) <= size {
+			next--
+		}
+		first = next
+	}
+
+	return spans
+}
@@ -0,0 +1,100 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkChunks verifies what every chunker guarantees: chunks are the text
+// between their offsets, stay on the page they report and measure at most
+// size.
+func checkChunks(t *testing.T, text string, chunks []Chunk, size int, m func(text []rune) int) {
+	t.Helper()
+	runes := []rune(text)
+	for i, c := range chunks {
+		if c.Start < 0 || c.End > len(runes) || c.Start > c.End {
+			t.Fatalf("chunk %d: bad range %d-%d of %d runes", i, c.Start, c.End, len(runes))
+		}
+		if got := string(runes[c.Start:c.End]); got != c.Text {
+			t.Errorf("chunk %d: text %q, runes %d-%d are %q", i, c.Text, c.Start, c.End, got)
+		}
+		if strings.ContainsRune(c.Text, '\f') {
+			t.Errorf("chunk %d: %q spans a page break", i, c.Text)
+		}
+		if page := strings.Count(string(runes[:c.Start]), "\f") + 1; c.Page != page {
+			t.Errorf("chunk %d: page %d, starts on page %d", i, c.Page, page)
+		}
+		if n := m([]rune(c.Text)); n > size {
+			t.Errorf("chunk %d: %q measures %d, more than %d", i, c.Text, n, size)
+		}
+	}
+}
+
+func countRunes(text []rune) int {
+	return len(text)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		strategy   string
+		opts       Options
+		wantParams string
+		wantErr    bool
+	}{
+		{strategy: StrategySentence, opts: Options{Overlap: -1}, wantParams: "size=800,overlap=200"},
+		{strategy: StrategySentence, opts: Options{Size: 400, Overlap: 0}, wantParams: "size=400,overlap=0"},
+		{strategy: StrategyWindow, opts: Options{Overlap: -1}, wantParams: "size=800,overlap=400"},
+		{strategy: StrategyWindow, opts: Options{Overlap: 0}, wantParams: "size=800,overlap=0"},
+		{strategy: StrategyRecursive, opts: Options{Size: 300, Overlap: -1}, wantParams: "size=300,overlap=200"},
+		{strategy: StrategyToken, opts: Options{Overlap: -1}, wantParams: "max_tokens=32,overlap=8"},
+		{strategy: StrategyToken, opts: Options{Overlap: 0}, wantParams: "max_tokens=32,overlap=0"},
+		{strategy: StrategySentence, opts: Options{Size: 100, Overlap: 100}, wantErr: true},
+		{strategy: StrategySentence, opts: Options{Size: -5, Overlap: 0}, wantErr: true},
+		{strategy: "paragraph", opts: Options{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		c, err := New(tt.strategy, tt.opts)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("New(%s, %+v) = %s, want an error", tt.strategy, tt.opts, c.Params())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%s, %+v): %v", tt.strategy, tt.opts, err)
+			continue
+		}
+		if c.Name() != tt.strategy || c.Params() != tt.wantParams {
+			t.Errorf("New(%s, %+v) = %s %s, want %s %s", tt.strategy, tt.opts, c.Name(), c.Params(), tt.strategy, tt.wantParams)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	text := "abcdefghij\fklmnopqrst"
+	tests := []struct {
+		size, overlap int
+		want          []Chunk
+	}{
+		{size: 8, overlap: 4, want: []Chunk{
+			{Text: "abcdefgh", Page: 1, Start: 0, End: 8},
+			{Text: "efghij\fk", Page: 1, Start: 4, End: 12},
+			{Text: "ij\fklmno", Page: 1, Start: 8, End: 16},
+			{Text: "lmnopqrs", Page: 2, Start: 12, End: 20},
+			{Text: "pqrst", Page: 2, Start: 16, End: 21},
+		}},
+		{size: 8, overlap: 0, want: []Chunk{
+			{Text: "abcdefgh", Page: 1, Start: 0, End: 8},
+			{Text: "ij\fklmno", Page: 1, Start: 8, End: 16},
+			{Text: "pqrst", Page: 2, Start: 16, End: 21},
+		}},
+	}
+	for _, tt := range tests {
+		w := &Window{Size: tt.size, Overlap: tt.overlap}
+		if got := w.Chunk(text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Window%+v.Chunk() = %+v, want %+v", *w, got, tt.want)
+		}
+	}
+}
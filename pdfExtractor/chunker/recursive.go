@@ -0,0 +1,93 @@
+package chunker
+
+import (
+	"unicode"
+)
+
+// separators are tried in order: a piece still longer than the chunk size
+// is split again on the next one.
+var separators = []string{"\n\n", "\n", ". ", " "}
+
+// Recursive splits every page on paragraphs, then lines, then sentences,
+// then words until the pieces fit into Size runes, and merges neighbouring
+// pieces back up to Size with Overlap runes shared between chunks.
+type Recursive struct {
+	Size    int
+	Overlap int
+}
+
+func (r *Recursive) Name() string {
+	return StrategyRecursive
+}
+
+func (r *Recursive) Params() string {
+	return params(r.Size, r.Overlap)
+}
+
+func (r *Recursive) Chunk(text string) []Chunk {
+	runes := []rune(text)
+
+	var chunks []Chunk
+	for i, page := range pages(runes) {
+		pieces := r.split(runes, page.start, page.end, separators)
+		chunks = append(chunks, chunksOf(runes, i+1, packUnits(pieces, r.Size, r.Overlap, runeCount))...)
+	}
+	return chunks
+}
+
+func (r *Recursive) split(runes []rune, start, end int, seps []string) []unit {
+	start, end = trim(runes, start, end)
+	if start == end {
+		return nil
+	}
+	if end-start <= r.Size {
+		return []unit{{start: start, end: end}}
+	}
+	if len(seps) == 0 {
+		var pieces []unit
+		for ; start < end; start += r.Size {
+			pieceEnd := start + r.Size
+			if pieceEnd > end {
+				pieceEnd = end
+			}
+			pieces = append(pieces, unit{start: start, end: pieceEnd})
+		}
+		return pieces
+	}
+
+	sep := []rune(seps[0])
+	var pieces []unit
+	pieceStart := start
+	for i := start; i+len(sep) <= end; i++ {
+		if !hasPrefix(runes[i:end], sep) {
+			continue
+		}
+		// The separator stays with the piece it ends.
+		pieces = append(pieces, r.split(runes, pieceStart, i+len(sep), seps[1:])...)
+		pieceStart = i + len(sep)
+		i = pieceStart - 1
+	}
+	if pieceStart == start {
+		return r.split(runes, start, end, seps[1:])
+	}
+	return append(pieces, r.split(runes, pieceStart, end, seps[1:])...)
+}
+
+func hasPrefix(runes []rune, prefix []rune) bool {
+	if len(runes) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if runes[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func trim(runes []rune, start, end int) (int, int) {
+	for start < end && unicode.IsSpace(runes[start]) {
+		start++
+	}
+	return start, trimRight(runes, start, end)
+}
@@ -0,0 +1,102 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecursive(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		text    string
+		want    []Chunk
+	}{
+		{
+			name:    "pages",
+			size:    800,
+			overlap: 200,
+			text:    "Sika roofing membranes are waterproof. Apply primer first.\fCuring takes a day. Keep it dry.",
+			want: []Chunk{
+				{Text: "Sika roofing membranes are waterproof. Apply primer first.", Page: 1, Start: 0, End: 58},
+				{Text: "Curing takes a day. Keep it dry.", Page: 2, Start: 59, End: 91},
+			},
+		},
+		{
+			name:    "overlap",
+			size:    32,
+			overlap: 16,
+			text:    "One two three. Four five six. Seven eight nine. Ten eleven twelve.",
+			want: []Chunk{
+				{Text: "One two three. Four five six.", Page: 1, Start: 0, End: 29},
+				{Text: "Four five six. Seven eight nine.", Page: 1, Start: 15, End: 47},
+				{Text: "Ten eleven twelve.", Page: 1, Start: 48, End: 66},
+			},
+		},
+		{
+			name:    "no overlap",
+			size:    32,
+			overlap: 0,
+			text:    "One two three. Four five six. Seven eight nine. Ten eleven twelve.",
+			want: []Chunk{
+				{Text: "One two three. Four five six.", Page: 1, Start: 0, End: 29},
+				{Text: "Seven eight nine.", Page: 1, Start: 30, End: 47},
+				{Text: "Ten eleven twelve.", Page: 1, Start: 48, End: 66},
+			},
+		},
+		{
+			name:    "paragraphs",
+			size:    24,
+			overlap: 0,
+			text:    "Primer dries quickly.\n\nMembrane is applied.",
+			want: []Chunk{
+				{Text: "Primer dries quickly.", Page: 1, Start: 0, End: 21},
+				{Text: "Membrane is applied.", Page: 1, Start: 23, End: 43},
+			},
+		},
+		{
+			name:    "word longer than size",
+			size:    8,
+			overlap: 0,
+			text:    "Waterproofing",
+			want: []Chunk{
+				{Text: "Waterpro", Page: 1, Start: 0, End: 8},
+				{Text: "ofing", Page: 1, Start: 8, End: 13},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Recursive{Size: tt.size, Overlap: tt.overlap}
+			got := r.Chunk(tt.text)
+			checkChunks(t, tt.text, got, tt.size, countRunes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Chunk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecursiveCoversText(t *testing.T) {
+	text := strings.Repeat("Sikaflex seals joints in concrete. ", 40) + "\f" +
+		strings.Repeat("Sikadur bonds steel\nto concrete\n\n", 30)
+	r := &Recursive{Size: 120, Overlap: 40}
+	chunks := r.Chunk(text)
+	checkChunks(t, text, chunks, 120, countRunes)
+
+	// Apart from whitespace, every rune is in a chunk.
+	covered := make([]bool, len([]rune(text)))
+	for _, c := range chunks {
+		for i := c.Start; i < c.End; i++ {
+			covered[i] = true
+		}
+	}
+	for i, r := range []rune(text) {
+		if !covered[i] && !strings.ContainsRune(" \n\f", r) {
+			t.Fatalf("rune %d %q is in no chunk", i, r)
+		}
+	}
+}
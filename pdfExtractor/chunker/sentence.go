@@ -0,0 +1,29 @@
+package chunker
+
+// Sentence fills chunks of at most Size runes with whole sentences,
+// headings and table rows, preferring to end them at a paragraph. Pages are
+// split first. Consecutive chunks of a page share up to Overlap runes of
+// whole sentences.
+type Sentence struct {
+	Size    int
+	Overlap int
+}
+
+func (s *Sentence) Name() string {
+	return StrategySentence
+}
+
+func (s *Sentence) Params() string {
+	return params(s.Size, s.Overlap)
+}
+
+func (s *Sentence) Chunk(text string) []Chunk {
+	runes := []rune(text)
+
+	var chunks []Chunk
+	for i, page := range pages(runes) {
+		units := splitUnits(runes, page.start, page.end, s.Size, runeCount)
+		chunks = append(chunks, chunksOf(runes, i+1, packUnits(units, s.Size, s.Overlap, runeCount))...)
+	}
+	return chunks
+}
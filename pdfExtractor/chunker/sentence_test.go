@@ -0,0 +1,94 @@
+package chunker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSentence(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		text    string
+		want    []Chunk
+	}{
+		{
+			name:    "pages",
+			size:    800,
+			overlap: 200,
+			text:    "Sika roofing membranes are waterproof. Apply primer first.\fCuring takes a day. Keep it dry.",
+			want: []Chunk{
+				{Text: "Sika roofing membranes are waterproof. Apply primer first.", Page: 1, Start: 0, End: 58},
+				{Text: "Curing takes a day. Keep it dry.", Page: 2, Start: 59, End: 91},
+			},
+		},
+		{
+			name:    "empty page",
+			size:    800,
+			overlap: 200,
+			text:    "First page.\f\fThird page.",
+			want: []Chunk{
+				{Text: "First page.", Page: 1, Start: 0, End: 11},
+				{Text: "Third page.", Page: 3, Start: 13, End: 24},
+			},
+		},
+		{
+			name:    "overlap",
+			size:    32,
+			overlap: 16,
+			text:    "One two three. Four five six. Seven eight nine. Ten eleven twelve.",
+			want: []Chunk{
+				{Text: "One two three. Four five six.", Page: 1, Start: 0, End: 29},
+				{Text: "Four five six. Seven eight nine.", Page: 1, Start: 15, End: 47},
+				{Text: "Ten eleven twelve.", Page: 1, Start: 48, End: 66},
+			},
+		},
+		{
+			name:    "no overlap",
+			size:    32,
+			overlap: 0,
+			text:    "One two three. Four five six. Seven eight nine. Ten eleven twelve.",
+			want: []Chunk{
+				{Text: "One two three. Four five six.", Page: 1, Start: 0, End: 29},
+				{Text: "Seven eight nine.", Page: 1, Start: 30, End: 47},
+				{Text: "Ten eleven twelve.", Page: 1, Start: 48, End: 66},
+			},
+		},
+		{
+			name:    "heading",
+			size:    800,
+			overlap: 0,
+			text:    "Application\nApply the primer.\n\nCuring\nLet it cure.",
+			want: []Chunk{
+				{Text: "Application\nApply the primer.\n\nCuring\nLet it cure.", Page: 1, Start: 0, End: 50},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Sentence{Size: tt.size, Overlap: tt.overlap}
+			got := s.Chunk(tt.text)
+			checkChunks(t, tt.text, got, tt.size, countRunes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Chunk() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentenceLongSentence(t *testing.T) {
+	text := "This sentence is much longer than the size of the chunks and is cut at whitespace."
+	s := &Sentence{Size: 20, Overlap: 0}
+	chunks := s.Chunk(text)
+	checkChunks(t, text, chunks, 20, countRunes)
+	if len(chunks) < 4 {
+		t.Fatalf("got %d chunks, want the sentence cut into at least 4", len(chunks))
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Start < chunks[i-1].End {
+			t.Errorf("chunks %d and %d overlap without Overlap", i-1, i)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package chunker
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// EmbeddingTokenLimit is the number of text tokens multimodalembedding@001
+// embeds; longer texts are truncated by the model.
+const EmbeddingTokenLimit = 32
+
+// Token fills chunks of at most MaxTokens tokens with whole sentences, like
+// Sentence does with runes, so that no chunk is truncated by the embedding
+// model. Overlap is in tokens as well.
+type Token struct {
+	MaxTokens int
+	Overlap   int
+}
+
+func (t *Token) Name() string {
+	return StrategyToken
+}
+
+func (t *Token) Params() string {
+	return fmt.Sprintf("max_tokens=%d,overlap=%d", t.MaxTokens, t.Overlap)
+}
+
+func (t *Token) Chunk(text string) []Chunk {
+	runes := []rune(text)
+	tokens := func(start, end int) int {
+		return CountTokens(runes[start:end])
+	}
+
+	var chunks []Chunk
+	for i, page := range pages(runes) {
+		units := splitUnits(runes, page.start, page.end, t.MaxTokens, tokens)
+		chunks = append(chunks, chunksOf(runes, i+1, packUnits(units, t.MaxTokens, t.Overlap, tokens))...)
+	}
+	return chunks
+}
+
+// CountTokens estimates the BPE tokens of text the way the chat backend
+// budgets prompts: short words are one token and long ones one per six
+// letters, digits go by three, punctuation marks and CJK characters are a
+// token each.
+func CountTokens(text []rune) int {
+	tokens := 0
+	letters, digits := 0, 0
+	flush := func() {
+		if letters > 0 {
+			tokens += 1 + (letters-1)/6
+			letters = 0
+		}
+		if digits > 0 {
+			tokens += 1 + (digits-1)/3
+			digits = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
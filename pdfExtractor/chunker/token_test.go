@@ -0,0 +1,85 @@
+package chunker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Apply the primer.", 4},
+		{"waterproofing", 3},
+		{"2023", 2},
+		{"Sika-Top 107", 4},
+		{"防水", 2},
+	}
+	for _, tt := range tests {
+		if got := CountTokens([]rune(tt.text)); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenLimit(t *testing.T) {
+	var sentences []string
+	for i := 0; i < 40; i++ {
+		sentences = append(sentences, fmt.Sprintf("Apply primer coat %d.", i))
+	}
+	long := "Supercalifragilisticexpialidocious waterproofing systematically protects " +
+		strings.Repeat("reinforced concrete structures ", 8) + "against water."
+
+	tests := []struct {
+		name    string
+		text    string
+		overlap int
+	}{
+		{name: "sentences", text: strings.Join(sentences, " "), overlap: 8},
+		{name: "no overlap", text: strings.Join(sentences, " "), overlap: 0},
+		{name: "pages", text: strings.Join(sentences[:10], " ") + "\f" + strings.Join(sentences[10:], "\n"), overlap: 8},
+		{name: "long sentence", text: long, overlap: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := &Token{MaxTokens: EmbeddingTokenLimit, Overlap: tt.overlap}
+			chunks := tk.Chunk(tt.text)
+			if len(chunks) < 2 {
+				t.Fatalf("got %d chunks, want the text split", len(chunks))
+			}
+			checkChunks(t, tt.text, chunks, EmbeddingTokenLimit, CountTokens)
+
+			for i := 1; i < len(chunks); i++ {
+				prev, c := chunks[i-1], chunks[i]
+				shared := prev.End - c.Start
+				if c.Page != prev.Page || shared <= 0 {
+					continue
+				}
+				if tt.overlap == 0 {
+					t.Errorf("chunks %d and %d share %q without overlap", i-1, i, c.Text[:shared])
+				} else if n := CountTokens([]rune(c.Text)[:shared]); n > tt.overlap {
+					t.Errorf("chunks %d and %d share %d tokens, more than %d", i-1, i, n, tt.overlap)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenOverlap(t *testing.T) {
+	text := "Apply primer coat one. Apply primer coat two. Apply primer coat three. " +
+		"Apply primer coat four. Apply primer coat five. Apply primer coat six. Apply primer coat seven."
+	tk := &Token{MaxTokens: EmbeddingTokenLimit, Overlap: 8}
+	chunks := tk.Chunk(text)
+	checkChunks(t, text, chunks, EmbeddingTokenLimit, CountTokens)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2: %+v", len(chunks), chunks)
+	}
+	// The last sentence of the first chunk opens the second one.
+	if want := "Apply primer coat six."; !strings.HasPrefix(chunks[1].Text, want) || !strings.HasSuffix(chunks[0].Text, want) {
+		t.Errorf("chunks %q and %q do not share %q", chunks[0].Text, chunks[1].Text, want)
+	}
+}
@@ -0,0 +1,51 @@
+package chunker
+
+import (
+	"sort"
+)
+
+// Window is the original scheme: a window of Size runes slid over the whole
+// text by Size-Overlap runes, ignoring pages and sentences. A chunk gets the
+// page it starts on.
+type Window struct {
+	Size    int
+	Overlap int
+}
+
+func (w *Window) Name() string {
+	return StrategyWindow
+}
+
+func (w *Window) Params() string {
+	return params(w.Size, w.Overlap)
+}
+
+func (w *Window) Chunk(text string) []Chunk {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+	pageSpans := pages(runes)
+
+	var chunks []Chunk
+	step := w.Size - w.Overlap
+	for start := 0; ; start += step {
+		end := start + w.Size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		page := sort.Search(len(pageSpans), func(i int) bool {
+			return pageSpans[i].end >= start
+		})
+		chunks = append(chunks, Chunk{
+			Text:  string(runes[start:end]),
+			Page:  page + 1,
+			Start: start,
+			End:   end,
+		})
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
@@ -1,65 +0,0 @@
-package esclient
-
-import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
-)
-
-// Request structure representing the data to be indexed
-type IndexRequest struct {
-	Content   string    `json:"content"`
-	Links     []string  `json:"links"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Embedding []float64 `json:"embedding"`
-	Offset    int       `json:"offset"`
-}
-
-// Response structure representing the Elasticsearch index response
-type IndexResponse struct {
-	Index   string `json:"_index"`
-	ID      string `json:"_id"`
-	Version int    `json:"_version"`
-	Result  string `json:"result"`
-}
-
-// Function to index data into Elasticsearch
-func IndexData(url, username, password string, data IndexRequest) (*IndexResponse, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Add Basic Authentication Header
-	auth := username + ":" + password
-	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var response IndexResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return nil, err
-	}
-
-	return &response, nil
-}
@@ -1,3 +1,7 @@
 module pdfextractor
 
 go 1.19
+
+require github.com/siriusfreak/hack-zurich-2023/lib v0.0.0
+
+replace github.com/siriusfreak/hack-zurich-2023/lib => ../lib
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"pdfextractor/chunker"
+	"pdfextractor/pipeline"
+
+	"github.com/siriusfreak/hack-zurich-2023/lib/embedding"
+	"github.com/siriusfreak/hack-zurich-2023/lib/vectorstore"
+)
+
+// ingestion runs the PDFs under the root through the stages of the
+// pipeline: discovery, text extraction and chunking, embedding and bulk
+// indexing. Every stage has its own pool of workers connected by bounded
+// channels, so a slow stage holds back the ones before it.
+type ingestion struct {
+	root        string
+	textChunker chunker.Chunker
+	force       bool
+
+	extractWorkers int
+	embedWorkers   int
+	indexWorkers   int
+	bulkSize       int
+
+	// embedBatch is the number of chunks passed to the embedder at once.
+	embedBatch int
+	embedder   embedding.Embedder
+	store      vectorstore.VectorStore
+	backoff    pipeline.Backoff
+	progress   *pipeline.Progress
+
+	// mu guards the manifest, updated by whichever index worker finishes a
+	// document.
+	mu           sync.Mutex
+	m            *manifest
+	manifestPath string
+}
+
+// pdfJob is a PDF found to be new or changed.
+type pdfJob struct {
+	path  string
+	meta  documentMetadata
+	entry *manifestEntry
+}
+
+// pdfDocument tracks the chunks of a PDF through the embedding and
+// indexing stages. The document is finished once every chunk succeeded or
+// failed.
+type pdfDocument struct {
+	pdfJob
+	chunkIDs []string
+	// legacyIDs are the IDs the first version of the extractor may have
+	// indexed the PDF under, for PDFs missing from the manifest.
+	legacyIDs []string
+
+	mu        sync.Mutex
+	remaining int
+	err       error
+}
+
+// chunkJob is a chunk on its way to the index.
+type chunkJob struct {
+	doc       *pdfDocument
+	index     int
+	chunk     chunker.Chunk
+	embedding []float64
+}
+
+// run ingests the PDFs under the root and returns the source files seen.
+func (in *ingestion) run(ctx context.Context) (map[string]bool, error) {
+	jobs := make(chan pdfJob, in.extractWorkers)
+	chunks := make(chan []*chunkJob, in.embedWorkers)
+	embedded := make(chan *chunkJob, in.bulkSize)
+
+	var extractWG, embedWG, indexWG sync.WaitGroup
+	for i := 0; i < in.extractWorkers; i++ {
+		extractWG.Add(1)
+		go func() {
+			defer extractWG.Done()
+			for job := range jobs {
+				in.extract(job, chunks)
+			}
+		}()
+	}
+	for i := 0; i < in.embedWorkers; i++ {
+		embedWG.Add(1)
+		go func() {
+			defer embedWG.Done()
+			for batch := range chunks {
+				in.embed(ctx, batch, embedded)
+			}
+		}()
+	}
+	for i := 0; i < in.indexWorkers; i++ {
+		indexWG.Add(1)
+		go func() {
+			defer indexWG.Done()
+			in.index(ctx, embedded)
+		}()
+	}
+
+	seen, err := in.discover(jobs)
+	close(jobs)
+	extractWG.Wait()
+	close(chunks)
+	embedWG.Wait()
+	close(embedded)
+	indexWG.Wait()
+
+	return seen, err
+}
+
+// discover walks the root and queues the PDFs that are new or changed.
+func (in *ingestion) discover(jobs chan<- pdfJob) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	err := filepath.Walk(in.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Error accessing path %s: %v\n", path, err)
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".pdf") {
+			return nil
+		}
+
+		meta := detectMetadata(in.root, path, info)
+		seen[meta.SourceFile] = true
+		in.progress.FilesFound.Add(1)
+
+		meta.DocumentID, err = documentID(path)
+		if err != nil {
+			log.Printf("Error hashing %s: %v\n", path, err)
+			in.progress.FilesFailed.Add(1)
+			return nil
+		}
+
+		in.mu.Lock()
+		entry := in.m.Files[meta.SourceFile]
+		in.mu.Unlock()
+		if !in.force && entry.upToDate(meta.DocumentID, in.textChunker.Name(), in.textChunker.Params(), in.embedder.Model()) {
+			in.progress.FilesSkipped.Add(1)
+			return nil
+		}
+
+		jobs <- pdfJob{path: path, meta: meta, entry: entry}
+		return nil
+	})
+	return seen, err
+}
+
+// extract chunks the text of the PDF and queues the chunks for embedding,
+// in batches of embedBatch.
+func (in *ingestion) extract(job pdfJob, chunks chan<- []*chunkJob) {
+	text, texts, err := extractTextFromPDF(job.path, in.textChunker)
+	if err != nil {
+		log.Printf("Error processing %s: %v\n", job.path, err)
+		in.progress.FilesFailed.Add(1)
+		return
+	}
+
+	doc := &pdfDocument{pdfJob: job, remaining: len(texts)}
+	for i := range texts {
+		doc.chunkIDs = append(doc.chunkIDs, chunkID(job.meta.SourceFile, job.meta.DocumentID, in.textChunker.Name(), in.textChunker.Params(), i))
+	}
+	if job.entry == nil {
+		doc.legacyIDs = legacyChunkIDs(filepath.Base(job.path), utf8.RuneCountInString(text))
+	}
+	if len(texts) == 0 {
+		in.finish(doc)
+		return
+	}
+
+	in.progress.Chunks.Add(int64(len(texts)))
+	size := in.embedBatch
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch := make([]*chunkJob, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, &chunkJob{doc: doc, index: i, chunk: texts[i]})
+		}
+		chunks <- batch
+	}
+}
+
+// embed embeds a batch of chunks and passes them on to indexing. Chunks
+// the service rejects fail on their own.
+func (in *ingestion) embed(ctx context.Context, batch []*chunkJob, embedded chan<- *chunkJob) {
+	texts := make([]string, 0, len(batch))
+	for _, c := range batch {
+		texts = append(texts, c.chunk.Text)
+	}
+
+	embeddings, err := in.embedder.Embed(ctx, texts)
+	var failed embedding.InstanceErrors
+	if err != nil && !errors.As(err, &failed) {
+		for _, c := range batch {
+			in.chunkDone(c.doc, fmt.Errorf("embedding chunk %d: %w", c.index, err))
+		}
+		return
+	}
+
+	for i, c := range batch {
+		if err := failed[i]; err != nil {
+			in.chunkDone(c.doc, fmt.Errorf("embedding chunk %d: %w", c.index, err))
+			continue
+		}
+		c.embedding = embeddings[i]
+		in.progress.Embedded.Add(1)
+		embedded <- c
+	}
+}
+
+// bulkFlushInterval bounds how long an incomplete bulk request waits for
+// more chunks.
+const bulkFlushInterval = time.Second
+
+// index posts the embedded chunks in bulk requests of up to bulkSize.
+func (in *ingestion) index(ctx context.Context, embedded <-chan *chunkJob) {
+	ticker := time.NewTicker(bulkFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*chunkJob
+	for {
+		select {
+		case c, ok := <-embedded:
+			if !ok {
+				in.flush(ctx, batch)
+				return
+			}
+			batch = append(batch, c)
+			if len(batch) >= in.bulkSize {
+				in.flush(ctx, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			in.flush(ctx, batch)
+			batch = nil
+		}
+	}
+}
+
+func (in *ingestion) flush(ctx context.Context, batch []*chunkJob) {
+	if len(batch) == 0 {
+		return
+	}
+
+	currentTime := time.Now().Format(time.RFC3339Nano)
+	docs := make([]vectorstore.Document, 0, len(batch))
+	for _, c := range batch {
+		meta := c.doc.meta
+		docs = append(docs, vectorstore.Document{
+			ID:        c.doc.chunkIDs[c.index],
+			Content:   c.chunk.Text,
+			Links:     []string{c.doc.path},
+			Offset:    c.chunk.Start,
+			CreatedAt: currentTime,
+			UpdatedAt: currentTime,
+			Embedding: c.embedding,
+
+			OffsetEnd:  c.chunk.End,
+			DocumentID: meta.DocumentID,
+			Page:       c.chunk.Page,
+
+			Chunker:        in.textChunker.Name(),
+			ChunkerParams:  in.textChunker.Params(),
+			EmbeddingModel: in.embedder.Model(),
+
+			SourceFile:      meta.SourceFile,
+			Language:        meta.Language,
+			ProductCategory: meta.ProductCategory,
+			DocumentType:    meta.DocumentType,
+			DocumentDate:    meta.DocumentDate,
+		})
+	}
+
+	err := pipeline.Retry(ctx, in.backoff, func() error {
+		return in.store.Upsert(ctx, docs)
+	})
+	if err != nil {
+		err = fmt.Errorf("indexing %d chunks: %w", len(batch), err)
+	} else {
+		in.progress.Indexed.Add(int64(len(batch)))
+	}
+	for _, c := range batch {
+		in.chunkDone(c.doc, err)
+	}
+}
+
+// chunkDone records the outcome of a chunk and finishes the document after
+// its last chunk. Only the first error of a document is kept.
+func (in *ingestion) chunkDone(doc *pdfDocument, err error) {
+	doc.mu.Lock()
+	if err != nil && doc.err == nil {
+		doc.err = err
+	}
+	doc.remaining--
+	last := doc.remaining == 0
+	doc.mu.Unlock()
+
+	if last {
+		in.finish(doc)
+	}
+}
+
+// finish removes the chunks the document no longer has and records it in
+// the manifest. A failed document keeps its old entry, so the next run
+// retries it.
+func (in *ingestion) finish(doc *pdfDocument) {
+	if doc.err != nil {
+		log.Printf("Error processing %s: %v\n", doc.path, doc.err)
+		in.progress.FilesFailed.Add(1)
+		return
+	}
+
+	if doc.entry != nil {
+		stale := staleChunks(doc.entry.ChunkIDs, doc.chunkIDs)
+		if err := in.store.Delete(context.Background(), stale); err != nil {
+			log.Printf("Error deleting %d stale chunks of %s: %v\n", len(stale), doc.path, err)
+			in.progress.FilesFailed.Add(1)
+			return
+		}
+	} else {
+		// Chunks indexed with a lost manifest are only known by their source
+		// file, the ones of the first version of the extractor by their IDs.
+		err := in.store.DeleteSourceFileExcept(context.Background(), doc.meta.SourceFile, doc.chunkIDs)
+		if err == nil {
+			err = in.store.Delete(context.Background(), staleChunks(doc.legacyIDs, doc.chunkIDs))
+		}
+		if err != nil {
+			log.Printf("Error deleting earlier chunks of %s: %v\n", doc.path, err)
+			in.progress.FilesFailed.Add(1)
+			return
+		}
+	}
+
+	in.mu.Lock()
+	in.m.Files[doc.meta.SourceFile] = &manifestEntry{
+		DocumentID:     doc.meta.DocumentID,
+		Chunker:        in.textChunker.Name(),
+		ChunkerParams:  in.textChunker.Params(),
+		EmbeddingModel: in.embedder.Model(),
+		ChunkIDs:       doc.chunkIDs,
+		IndexedAt:      time.Now().UTC(),
+	}
+	err := in.m.save(in.manifestPath)
+	in.mu.Unlock()
+	if err != nil {
+		log.Printf("Error saving manifest: %v\n", err)
+	}
+
+	in.progress.FilesDone.Add(1)
+	log.Printf("Indexed %d chunks of %v\n", len(doc.chunkIDs), doc.path)
+}
@@ -1,181 +1,213 @@
 package main
 
 import (
-	"bufio"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
+	"encoding/base64"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
-	"pdfextractor/client"
-	"pdfextractor/esclient"
-)
+	"pdfextractor/chunker"
+	"pdfextractor/pipeline"
 
-const (
-	offset          = 400
-	symbolsPerBlock = 800
+	"github.com/siriusfreak/hack-zurich-2023/lib/embedding"
+	"github.com/siriusfreak/hack-zurich-2023/lib/vectorstore"
 )
 
-var projectId = "hackzurich23-8200"
-var url = "https://hz.siriusfrk.me/sika_chat_index/_doc/"
+var indexURL = "https://hz.siriusfrk.me/sika_chat_index"
 var username = ""
 var password = "" //
 
-func main() {
-	rootDirectory := "../"
-
-	err := filepath.Walk(rootDirectory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error accessing path %s: %v\n", path, err)
-			return nil
-		}
-
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".pdf") {
-			processPDFFile(path, info.Name())
-			log.Printf("Path: %v\n", path)
-			log.Printf("Name: %v\n", info.Name())
-		}
+var (
+	rootFlag         = flag.String("root", "../", "directory searched recursively for PDFs")
+	languageFlag     = flag.String("language", "en", "language of the documents")
+	categoryFlag     = flag.String("category", "", "product category of the documents (default: name of the directory holding each PDF)")
+	documentTypeFlag = flag.String("type", "", "document type (default: guessed from the file name)")
+	chunkerFlag      = flag.String("chunker", chunker.StrategySentence, "chunking strategy: "+strings.Join(chunker.Strategies(), ", "))
+	chunkSizeFlag    = flag.Int("chunk-size", 0, "maximal chunk size in characters, or tokens for the token chunker (default: strategy default)")
+	chunkOverlapFlag = flag.Int("chunk-overlap", -1, "size repeated from the previous chunk, 0 for none (default: strategy default)")
+	manifestFlag     = flag.String("manifest", "manifest.json", "file recording the indexed PDFs, for incremental runs")
+	forceFlag        = flag.Bool("force", false, "reindex all PDFs, even unchanged ones")
+
+	extractWorkersFlag = flag.Int("extract-workers", 2, "number of PDFs extracted and chunked in parallel")
+	embedWorkersFlag   = flag.Int("embed-workers", 4, "number of parallel embedding requests")
+	indexWorkersFlag   = flag.Int("index-workers", 1, "number of parallel bulk index requests")
+	embedRateFlag      = flag.Float64("embed-rate", 2, "embedding requests per second, to stay within the Vertex AI quota (0: unlimited)")
+	embedBatchFlag     = flag.Int("embed-batch", 0, "chunks per embedding request, lowered automatically when the model rejects the batches (default: the limit of the model, 1 for multimodalembedding@001, which makes one request per chunk)")
+
+	retriesFlag  = flag.Int("retries", 4, "retries of a failing embedding or bulk index request")
+	bulkSizeFlag = flag.Int("bulk-size", 100, "chunks per bulk index request")
+	progressFlag = flag.Duration("progress", 10*time.Second, "interval between progress reports")
+
+	storeFlag     = flag.String("store", vectorstore.KindElasticsearch, "document store: elasticsearch, or flat to keep the chunks in the file given by -store-path")
+	storePathFlag = flag.String("store-path", "store.jsonl", "file of the flat store")
+	indexFlag     = flag.String("index", indexURL, "URL of the Elasticsearch index")
+	embedderFlag  = flag.String("embedder", embedding.ProviderVertex, "embedding provider: vertex, or hashing to embed locally without network")
+	dimensionFlag = flag.Int("dimension", 0, "length of the embeddings (default: the one of the model)")
+	projectFlag   = flag.String("project", "hackzurich23-8200", "Google Cloud project of the Vertex AI embedding model")
+	regionFlag    = flag.String("region", embedding.DefaultRegion, "Vertex AI region")
+	modelFlag     = flag.String("model", embedding.DefaultModel, "embedding model; the chat backend must embed questions with the same one")
+	endpointFlag  = flag.String("endpoint", "", "prediction API address (default: the one of the region)")
+)
 
-		return nil
+func main() {
+	flag.Parse()
+	indexURL = *indexFlag
+	rootDirectory := *rootFlag
+	textChunker, err := chunker.New(*chunkerFlag, chunker.Options{
+		Size:    *chunkSizeFlag,
+		Overlap: *chunkOverlapFlag,
 	})
-
 	if err != nil {
-		log.Printf("Error walking directory: %v\n", err)
+		log.Fatal(err)
+	}
+	log.Printf("Chunking with %s (%s)\n", textChunker.Name(), textChunker.Params())
+
+	embedder, err := embedding.New(embedding.Config{
+		Provider:     *embedderFlag,
+		Dimension:    *dimensionFlag,
+		ProjectID:    *projectFlag,
+		Region:       *regionFlag,
+		Model:        *modelFlag,
+		Endpoint:     *endpointFlag,
+		MaxInstances: *embedBatchFlag,
+		Retries:      *retriesFlag,
+		Limiter:      pipeline.NewTokenBucket(*embedRateFlag, *embedWorkersFlag),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Embedding with %s (dimension %d)\n", embedder.Model(), embedder.Dimension())
+	embedBatch := *embedBatchFlag
+	if embedBatch < 1 {
+		embedBatch = embedding.MaxInstances(embedder.Model())
 	}
-}
 
-func processPDFFile(pdfPath, fileName string) {
+	// Files missing from the walk are removed from the index, so a wrong root
+	// must not look like an empty one.
+	if _, err := os.Stat(rootDirectory); err != nil {
+		log.Fatal(err)
+	}
 
-	textBlocks, err := extractTextFromPDF(pdfPath)
+	store, err := vectorstore.Open(vectorstore.Config{
+		Kind:           *storeFlag,
+		IndexURL:       indexURL,
+		Authorization:  "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+		Path:           *storePathFlag,
+		EmbeddingModel: embedder.Model(),
+		Dimension:      embedder.Dimension(),
+	})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error extracting text:", err)
-		os.Exit(1)
-	}
-
-	i := 0
-
-	for lineNum, block := range textBlocks {
-		prediction, error := client.MakePredictionRequest(projectId, client.PredictRequest{
-			Instances: []client.Instance{
-				{
-					Text: block,
-				},
-			},
-		})
-		if error != nil {
-			fmt.Println("Error:", error)
-			return
-		}
-		embed := prediction.Predictions
-
-		md5, err := calculateMD5(fileName, i)
+		log.Fatal(err)
+	}
 
-		if err != nil {
-			fmt.Println("Error:", error)
-			return
-		}
+	m, err := loadManifest(*manifestFlag, store.Location())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		if prediction.Predictions == nil {
-			fmt.Println("Error getting embeddings:", block)
-			fmt.Println(prediction)
-			return
+	if es, ok := store.(*vectorstore.Elastic); ok {
+		if err := es.PutMetadataMapping(context.Background()); err != nil {
+			log.Printf("Error updating index mapping: %v\n", err)
 		}
-
-		currentTime := time.Now().Format(time.RFC3339Nano)
-		fmt.Println(currentTime)
-
-		response, err := esclient.IndexData(url+md5, username, password, esclient.IndexRequest{
-			Content:   block,
-			Links:     []string{pdfPath},
-			Offset:    lineNum * offset,
-			CreatedAt: currentTime,
-			UpdatedAt: currentTime,
-			Embedding: embed[len(embed)-1].TextEmbedding, // add more values to match the dimension specified in the index settings
-		})
-		i = i + 1
-		if err != nil {
-			fmt.Println("Error:", err)
-			return
+		if err := checkEmbeddingMapping(es, embedder.Dimension()); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		fmt.Println("Response:", response)
+	in := &ingestion{
+		root:           rootDirectory,
+		textChunker:    textChunker,
+		force:          *forceFlag,
+		extractWorkers: atLeastOne(*extractWorkersFlag),
+		embedWorkers:   atLeastOne(*embedWorkersFlag),
+		indexWorkers:   atLeastOne(*indexWorkersFlag),
+		bulkSize:       atLeastOne(*bulkSizeFlag),
+		embedBatch:     embedBatch,
+		embedder:       embedder,
+		store:          store,
+		backoff: pipeline.Backoff{
+			Attempts: *retriesFlag + 1,
+			Initial:  time.Second,
+			Max:      30 * time.Second,
+		},
+		progress:     &pipeline.Progress{},
+		m:            m,
+		manifestPath: *manifestFlag,
 	}
-}
 
-func pdfToText(path string) (string, error) {
-	out, err := exec.Command("pdftotext", path, "-").Output()
-	return string(out), err
-}
+	progressCtx, stopProgress := context.WithCancel(context.Background())
+	go in.progress.Report(progressCtx, *progressFlag)
+	seen, err := in.run(context.Background())
+	stopProgress()
+	if err != nil {
+		log.Fatalf("Error walking directory: %v\n", err)
+	}
+	log.Printf("Done: %s\n", in.progress)
 
-func rotate(inp []string) {
-	for i, l := offset, len(inp); i < l; i++ {
-		inp[i-offset] = inp[i]
+	for sourceFile, entry := range m.Files {
+		if seen[sourceFile] {
+			continue
+		}
+		if err := store.Delete(context.Background(), entry.ChunkIDs); err != nil {
+			log.Printf("Error deleting chunks of removed %s: %v\n", sourceFile, err)
+			continue
+		}
+		delete(m.Files, sourceFile)
+		log.Printf("Removed %d chunks of %s\n", len(entry.ChunkIDs), sourceFile)
+	}
+	if err := m.save(*manifestFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		log.Fatal(err)
 	}
 }
 
-func glue(inp []string) string {
-	var sb strings.Builder
-	for i, l := 0, len(inp); i < l; i++ {
-		sb.WriteString(inp[i])
+// checkEmbeddingMapping keeps the index consistent with the embedder: a
+// new index gets the declared dimension, and an index of another dimension
+// is refused, since its vectors come from another model.
+func checkEmbeddingMapping(es *vectorstore.Elastic, dimension int) error {
+	if dimension == 0 {
+		return nil
 	}
-	return sb.String()
-}
 
-func extractTextFromPDF(path string) (map[int]string, error) {
-	text, err := pdfToText(path)
+	dims, err := es.EmbeddingDims(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("pdfToText: %w", err)
+		log.Printf("Error reading the embedding mapping: %v\n", err)
+		return nil
 	}
-
-	textBlocks := make(map[int]string)
-	scanner := bufio.NewScanner(strings.NewReader(text))
-	scanner.Split(bufio.ScanRunes)
-	window := make([]string, symbolsPerBlock)
-
-	for i := 0; i < symbolsPerBlock && scanner.Scan(); i++ {
-		window[i] = scanner.Text()
+	if dims == 0 {
+		return es.PutEmbeddingMapping(context.Background(), dimension)
 	}
-
-	textBlocks[len(textBlocks)] = glue(window)
-	rotate(window)
-
-	windowCurrent := offset
-	for scanner.Scan() {
-		if windowCurrent == len(window) {
-			windowCurrent = offset
-			textBlocks[len(textBlocks)] = glue(window)
-			rotate(window)
-		}
-
-		window[windowCurrent] = scanner.Text()
-		windowCurrent++
+	if dims != dimension {
+		return fmt.Errorf("index %s holds embeddings of dimension %d, the embedder produces %d; use another -index", indexURL, dims, dimension)
 	}
+	return nil
+}
 
-	for i := windowCurrent; i < len(window); i++ {
-		window[i] = ""
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
 	}
-	textBlocks[len(textBlocks)] = glue(window)
-
-	return textBlocks, nil
+	return n
 }
 
-func calculateMD5(text string, number int) (string, error) {
-	// Concatenate the text and the integer as a string
-	input := fmt.Sprintf("%s%d", text, number)
+func pdfToText(path string) (string, error) {
+	out, err := exec.Command("pdftotext", path, "-").Output()
+	return string(out), err
+}
 
-	// Calculate the MD5 hash
-	hasher := md5.New()
-	_, err := hasher.Write([]byte(input))
+// extractTextFromPDF returns the text of the PDF and its chunks.
+func extractTextFromPDF(path string, textChunker chunker.Chunker) (string, []chunker.Chunk, error) {
+	text, err := pdfToText(path)
 	if err != nil {
-		return "", err
+		return "", nil, fmt.Errorf("pdfToText: %w", err)
 	}
 
-	// Convert the hash to a hexadecimal string
-	hashSum := hex.EncodeToString(hasher.Sum(nil))
-	return hashSum, nil
+	return text, textChunker.Chunk(text), nil
 }
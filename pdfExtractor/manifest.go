@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/siriusfreak/hack-zurich-2023/lib/embedding"
+)
+
+// manifest records what has been indexed, so that a run only processes new
+// and changed PDFs and removes the chunks of changed and deleted ones.
+type manifest struct {
+	// Index is the index the chunks were posted to. A manifest of another
+	// index is ignored.
+	Index string `json:"index"`
+	// Files maps source files, relative to the root, to their entry.
+	Files map[string]*manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	DocumentID     string    `json:"document_id"`
+	Chunker        string    `json:"chunker"`
+	ChunkerParams  string    `json:"chunker_params"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	ChunkIDs       []string  `json:"chunk_ids"`
+	IndexedAt      time.Time `json:"indexed_at"`
+}
+
+// loadManifest reads the manifest at path. A missing file or a manifest of
+// another index gives an empty manifest.
+func loadManifest(path, index string) (*manifest, error) {
+	m := &manifest{Index: index, Files: make(map[string]*manifestEntry)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded manifest
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	if loaded.Index != index {
+		log.Printf("Manifest %s is for index %s, reindexing everything into %s\n", path, loaded.Index, index)
+		return m, nil
+	}
+	if loaded.Files != nil {
+		m.Files = loaded.Files
+	}
+
+	return m, nil
+}
+
+// save writes the manifest atomically, so that an interrupted run leaves
+// the previous version.
+func (m *manifest) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// upToDate tells whether the file was indexed with the same content,
+// chunking and embedding model.
+func (e *manifestEntry) upToDate(documentID, chunkerName, chunkerParams, embeddingModel string) bool {
+	if e == nil {
+		return false
+	}
+	// Entries written before the model was recorded were embedded with the
+	// default Vertex model.
+	model := e.EmbeddingModel
+	if model == "" {
+		model = embedding.DefaultModel
+	}
+	return e.DocumentID == documentID && e.Chunker == chunkerName && e.ChunkerParams == chunkerParams && model == embeddingModel
+}
+
+// chunkID identifies the i-th chunk of a source file. It depends on the file
+// path, content and chunking, so that files with the same name in other
+// folders do not collide and rerunning on unchanged input rewrites the same
+// documents.
+func chunkID(sourceFile, documentID, chunkerName, chunkerParams string, i int) string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\x00%s\x00%s\x00%s\x00%d", sourceFile, documentID, chunkerName, chunkerParams, i)
+	return hex.EncodeToString(hasher.Sum(nil))[:32]
+}
+
+// staleChunks returns the IDs of previous that are not in current.
+func staleChunks(previous, current []string) []string {
+	keep := make(map[string]bool, len(current))
+	for _, id := range current {
+		keep[id] = true
+	}
+
+	var stale []string
+	for _, id := range previous {
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	return stale
+}
+
+// legacyChunkIDs returns the IDs the first version of the extractor may have
+// indexed the PDF fileName under, given the length of its text in runes.
+// That version keyed the chunks by the MD5 of the base name of the file
+// followed by the chunk number, with a chunk every 400 runes, and indexed no
+// source file, so only these IDs find its chunks.
+func legacyChunkIDs(fileName string, runes int) []string {
+	count := runes/400 + 2
+	ids := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		sum := md5.Sum([]byte(fmt.Sprintf("%s%d", fileName, i)))
+		ids = append(ids, hex.EncodeToString(sum[:]))
+	}
+	return ids
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// documentMetadata is indexed with every chunk of a PDF so that the chat
+// backend can filter on it.
+type documentMetadata struct {
+	// DocumentID identifies the PDF by its content, see documentID.
+	DocumentID      string
+	SourceFile      string
+	Language        string
+	ProductCategory string
+	DocumentType    string
+	DocumentDate    string
+}
+
+const (
+	typeProductDataSheet = "product_data_sheet"
+	typeSafetyDataSheet  = "safety_data_sheet"
+	typeDocument         = "document"
+)
+
+// detectMetadata fills in the metadata of the PDF at path. Flags win over
+// what is guessed from the file: the product category defaults to the name
+// of the directory holding the PDF, the type to a guess from the file name,
+// the date to the PDF creation date or else the modification time.
+func detectMetadata(rootDirectory, path string, info os.FileInfo) documentMetadata {
+	sourceFile, err := filepath.Rel(rootDirectory, path)
+	if err != nil {
+		sourceFile = path
+	}
+	sourceFile = filepath.ToSlash(sourceFile)
+
+	meta := documentMetadata{
+		SourceFile:      sourceFile,
+		Language:        *languageFlag,
+		ProductCategory: *categoryFlag,
+		DocumentType:    *documentTypeFlag,
+		DocumentDate:    pdfCreationDate(path),
+	}
+
+	if meta.ProductCategory == "" {
+		dir := filepath.Base(filepath.Dir(path))
+		if dir != "." && dir != ".." && dir != string(filepath.Separator) {
+			meta.ProductCategory = dir
+		}
+	}
+	if meta.DocumentType == "" {
+		meta.DocumentType = guessDocumentType(info.Name())
+	}
+	if meta.DocumentDate == "" {
+		meta.DocumentDate = info.ModTime().UTC().Format("2006-01-02")
+	}
+
+	return meta
+}
+
+func guessDocumentType(fileName string) string {
+	name := strings.ToLower(fileName)
+	switch {
+	case strings.Contains(name, "sds") || strings.Contains(name, "safety"):
+		return typeSafetyDataSheet
+	case strings.Contains(name, "pds") || strings.Contains(name, "data-sheet") ||
+		strings.Contains(name, "datasheet") || strings.Contains(name, "data_sheet"):
+		return typeProductDataSheet
+	default:
+		return typeDocument
+	}
+}
+
+// pdfCreationDate returns the CreationDate reported by pdfinfo as
+// YYYY-MM-DD, or "" when it is not available.
+func pdfCreationDate(path string) string {
+	out, err := exec.Command("pdfinfo", "-isodates", path).Output()
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "CreationDate:") {
+			continue
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(line, "CreationDate:"))
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02")
+	}
+
+	return ""
+}
+
+// documentID returns the hex SHA-256 of the PDF content. The chat backend
+// registers the PDFs it serves under the same ID, so chunks can link to
+// their source wherever the file lives.
+func documentID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Progress counts the work done by the ingestion stages.
+type Progress struct {
+	FilesFound   atomic.Int64
+	FilesSkipped atomic.Int64
+	FilesDone    atomic.Int64
+	FilesFailed  atomic.Int64
+	Chunks       atomic.Int64
+	Embedded     atomic.Int64
+	Indexed      atomic.Int64
+}
+
+func (p *Progress) String() string {
+	return fmt.Sprintf("files: %d found, %d unchanged, %d done, %d failed; chunks: %d embedded, %d indexed of %d",
+		p.FilesFound.Load(), p.FilesSkipped.Load(), p.FilesDone.Load(), p.FilesFailed.Load(),
+		p.Embedded.Load(), p.Indexed.Load(), p.Chunks.Load())
+}
+
+// Report logs the progress every interval until ctx is done.
+func (p *Progress) Report(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Printf("Progress: %s\n", p)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Backoff configures Retry.
+type Backoff struct {
+	Attempts int
+	// Initial is the delay before the first retry; it doubles with every
+	// further retry up to Max.
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// permanentError stops Retry.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// temporary is implemented by errors that know whether a retry may succeed,
+// like net.Error and the status errors of the HTTP clients.
+type temporary interface {
+	Temporary() bool
+}
+
+// Retry calls fn until it succeeds, the attempts are used up or fn returns
+// an error that is Permanent or not Temporary. Delays are jittered so that
+// workers hitting a quota together do not retry together.
+func Retry(ctx context.Context, b Backoff, fn func() error) error {
+	delay := b.Initial
+	if delay <= 0 {
+		delay = time.Second
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		var t temporary
+		if errors.As(err, &t) && !t.Temporary() {
+			return err
+		}
+		if attempt >= b.Attempts {
+			return err
+		}
+
+		jittered := delay/2 + time.Duration(rand.Int63n(int64(delay)+1))
+		timer := time.NewTimer(jittered)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if b.Max > 0 && delay > b.Max {
+			delay = b.Max
+		}
+	}
+}